@@ -4,11 +4,34 @@ import (
 	"io/ioutil"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
 func main() {
-	directory := os.Args[1]
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	if os.Args[1] == "disasm" {
+		disassemble(os.Args[2:])
+		return
+	}
+
+	if os.Args[1] == "verify" {
+		verify(os.Args[2:])
+		return
+	}
+
+	// Binaries get a debug section, unless it is asked to be left out
+	directory, debug := os.Args[1], true
+	if directory == "-nodebug" {
+		if len(os.Args) < 3 {
+			usage()
+		}
+
+		directory, debug = os.Args[2], false
+	}
 
 	dataRt, err := ioutil.ReadFile(directory + "/runtime.arl")
 	if err != nil {
@@ -17,14 +40,29 @@ func main() {
 
 	runtime, err := ParseRuntime(string(dataRt))
 	if err != nil {
-		panic(fmt.Errorf("error parsing runtime: %s", err))
+		fmt.Fprintf(os.Stderr, "error parsing runtime: %s\n", err)
+		os.Exit(1)
 	}
 
 	fmt.Printf("Loaded runtime with %d functions and %d listeners.\n", len(runtime.Functions), len(runtime.Listeners))
-	compileRecursive(runtime, directory, "")
+	if failed := compileRecursive(runtime, directory, "", debug); failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d file(s) failed to compile\n", failed)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: adderc [-nodebug] <project directory>")
+	fmt.Fprintln(os.Stderr, "       adderc disasm <file.abf> [runtime.arl]")
+	fmt.Fprintln(os.Stderr, "       adderc verify <file.abf> <runtime.arl>")
+	os.Exit(2)
 }
 
-func compileRecursive(runtime *AdderRuntime, base string, dir string) {
+// compileRecursive compiles every file in the source directory and its subdirectories. A file that fails to compile
+// does not stop the others from being compiled; the number of failed files is returned. The binaries get a debug
+// section if debug is set.
+func compileRecursive(runtime *AdderRuntime, base string, dir string, debug bool) int {
+	failed := 0
 	fmt.Printf("Compiling recursive: %s %s\n", base, dir)
 	srcbase := base + "/src/" + dir
 	entries, e := ioutil.ReadDir(srcbase)
@@ -32,30 +70,114 @@ func compileRecursive(runtime *AdderRuntime, base string, dir string) {
 	if e == nil {
 		for _, v := range entries {
 			if v.IsDir() {
-				compileRecursive(runtime, base, dir + "/" + v.Name())
+				failed += compileRecursive(runtime, base, dir + "/" + v.Name(), debug)
 			} else {
-				data, err := ioutil.ReadFile(srcbase + "/" + v.Name())
+				file := filepath.Join(srcbase, v.Name())
+				data, err := ioutil.ReadFile(file)
 				if err != nil {
-					panic(err)
+					fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+					failed++
+					continue
 				}
 
-				text := string(data)
-				tokens := ScanText(text)
+				assembler, diagnostics := Compile(runtime, file, string(data))
+				for _, d := range diagnostics {
+					printDiagnostic(d)
+				}
 
-				ast := Parse(text, tokens)
-				program := ProcessAndAnalyzeProgram(runtime, ast)
+				if assembler == nil {
+					failed++
+					continue
+				}
 
-				assembler := Assembler{program: program}
-				assembler.AssembleProgram()
+				fmt.Println()
 				assembler.PrettyPrint()
 
+				if !debug {
+					assembler.StripDebugInfo()
+				}
+
 				os.MkdirAll(base + "/bin/" + dir, os.ModePerm)
 				err = assembler.EncodeToFile(base + "/bin/" + dir + "/" + strings.Replace(v.Name(), ".adr", ".abf", -1))
 
 				if err != nil {
-					panic(err)
+					fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+					failed++
 				}
 			}
 		}
 	}
+
+	return failed
+}
+
+// printDiagnostic prints a diagnostic compiler-style, followed by the offending line if the location is known.
+func printDiagnostic(d Diagnostic) {
+	fmt.Fprintln(os.Stderr, d.Error())
+	if d.Indicator != "" {
+		fmt.Fprintln(os.Stderr, d.Indicator)
+	}
+}
+
+// disassemble prints the listing of a compiled binary. The runtime definition is optional, and only used to print the
+// names of native functions and listeners.
+func disassemble(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: adderc disasm <file.abf> [runtime.arl]")
+		os.Exit(2)
+	}
+
+	bin, err := DecodeFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err)
+		os.Exit(1)
+	}
+
+	var runtime *AdderRuntime
+	if len(args) > 1 {
+		dataRt, err := ioutil.ReadFile(args[1])
+		if err == nil {
+			runtime, err = ParseRuntime(string(dataRt))
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading runtime: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	bin.PrettyPrint(runtime)
+}
+
+// verify checks a compiled binary against a runtime definition, the same way an interpreter does before running it.
+func verify(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: adderc verify <file.abf> <runtime.arl>")
+		os.Exit(2)
+	}
+
+	bin, err := DecodeFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err)
+		os.Exit(1)
+	}
+
+	dataRt, err := ioutil.ReadFile(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error loading runtime: %s\n", err)
+		os.Exit(1)
+	}
+
+	runtime, err := ParseRuntime(string(dataRt))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing runtime: %s\n", err)
+		os.Exit(1)
+	}
+
+	if err := Verify(bin, runtime); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s: ok\n", args[0])
 }
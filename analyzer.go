@@ -13,6 +13,12 @@ type AnalyzedProgram struct {
 	runtime      *AdderRuntime
 	methodIndex  int
 	triggerIndex int
+
+	// constants holds the value of every constant declared in the runtime or the script, by name.
+	constants map[string]*ASTLiteralExpr
+	globals   []*GlobalVariable
+
+	diagnostics []Diagnostic
 }
 
 type Trigger struct {
@@ -28,10 +34,31 @@ type Method struct {
 	instructions []*Instruction
 	variables    []*LocalVariable
 	arguments    []*LocalVariable
+	returnType   VariableType
 	entry        *Instruction
 
+	// scope holds the variables visible at the current point of analysis. Variables declared in a block go out of
+	// scope at the end of it, but keep their slot in the local variable table.
+	scope     []*LocalVariable
+	loopDepth int
+
+	// loops holds the jump targets of the loops enclosing the statement being assembled, innermost last.
+	loops []loopLabels
+
 	lvtIndex int
 	labelPtr int
+
+	// maxStack is the highest the operand stack gets while the method runs, arguments included, as computed by the
+	// assembler.
+	maxStack int
+
+	// span is the source of the node being assembled, which the instructions emitted for it are attributed to.
+	span Span
+}
+
+type loopLabels struct {
+	continueLabel *Instruction
+	breakLabel    *Instruction
 }
 
 type LocalVariable struct {
@@ -40,6 +67,18 @@ type LocalVariable struct {
 	typ   VariableType
 }
 
+// GlobalVariable is a variable declared at the top level of a script. Globals keep their value for as long as the
+// script is loaded, and persistent ones are saved and restored by the host across restarts.
+type GlobalVariable struct {
+	index   int
+	name    string
+	typ     VariableType
+	persist bool
+
+	// value is the initial value of the global.
+	value *ASTLiteralExpr
+}
+
 type VariableType struct {
 	builtin bool
 	keyword string
@@ -49,6 +88,7 @@ type VariableType struct {
 var (
 	VarTypeInt    = VariableType{builtin: true, keyword: "int"}
 	VarTypeLong   = VariableType{builtin: true, keyword: "long"}
+	VarTypeFloat  = VariableType{builtin: true, keyword: "float"}
 	VarTypeString = VariableType{builtin: true, keyword: "string"}
 	VarTypeBool   = VariableType{builtin: true, keyword: "bool"}
 	VarTypeVoid   = VariableType{builtin: true, keyword: "void"} // Not a variable type, but defined to be used with method types
@@ -56,8 +96,28 @@ var (
 	VarTypeUnresolved = VariableType{builtin: true, keyword: "MISSING_TYPE"}
 )
 
-func ProcessAndAnalyzeProgram(runtime *AdderRuntime, rootNodes []ASTNode) AnalyzedProgram {
-	program := AnalyzedProgram{runtime: runtime, Nodes: rootNodes}
+// ProcessAndAnalyzeProgram resolves and type checks the parsed program. Analysis continues after an error, so all
+// problems in the program are reported at once.
+func ProcessAndAnalyzeProgram(runtime *AdderRuntime, rootNodes []ASTNode) (AnalyzedProgram, []Diagnostic) {
+	program := AnalyzedProgram{runtime: runtime, Nodes: rootNodes, constants: map[string]*ASTLiteralExpr{}}
+
+	// Constants are defined before any code is analyzed, so code and globals can use them anywhere in the file. The value
+	// of a constant can only refer to the constants declared before it, which are the only ones defined at that point.
+	for _, v := range runtime.Constants {
+		program.constants[v.Name] = literalOf(Span{}, v.Value)
+	}
+
+	for _, v := range rootNodes {
+		if v.Type() == TypeConstDecl {
+			program.defineConst(v.(*ASTConstDecl))
+		}
+	}
+
+	for _, v := range rootNodes {
+		if v.Type() == TypeGlobalDecl {
+			program.defineGlobal(v.(*ASTGlobalDecl))
+		}
+	}
 
 	// Hoist function declarations
 	for _, v := range rootNodes {
@@ -70,7 +130,11 @@ func ProcessAndAnalyzeProgram(runtime *AdderRuntime, rootNodes []ASTNode) Analyz
 		program.analyzeNode(v, nil)
 	}
 
-	return program
+	return program, program.diagnostics
+}
+
+func (p *AnalyzedProgram) error(code DiagnosticCode, span Span, format string, args ...interface{}) {
+	p.diagnostics = append(p.diagnostics, newError(code, span, format, args...))
 }
 
 func (p *AnalyzedProgram) analyzeNode(node ASTNode, method *Method) {
@@ -83,66 +147,214 @@ func (p *AnalyzedProgram) analyzeNode(node ASTNode, method *Method) {
 		p.analyzeBlock(n, method)
 	case *ASTVarDeclaration:
 		p.analyzeVarDecl(n, method)
+	case *ASTVarAssign:
+		p.analyzeVarAssign(n, method)
 	case *ASTMethodExpr:
 		p.analyzeMethodExpr(n, method)
+	case *ASTExprStatement:
+		p.analyzeNode(n.expression, method)
 	case *ASTLiteralExpr:
 		p.analyzeLiteralExpr(n, method)
 	case *ASTIfStmt:
 		p.analyzeIfStatement(n, method)
+	case *ASTWhileStmt:
+		p.analyzeWhileStmt(n, method)
+	case *ASTForStmt:
+		p.analyzeForStmt(n, method)
+	case *ASTBreakStmt:
+		p.analyzeBranchStmt(n.Span, "break", method)
+	case *ASTContinueStmt:
+		p.analyzeBranchStmt(n.Span, "continue", method)
+	case *ASTReturnStmt:
+		p.analyzeReturnStmt(n, method)
 	case *ASTLogicalExpr:
 		p.analyzeLogicalExpr(n, method)
 	case *ASTIdentifierExpr:
 		p.analyzeIdentifierExpr(n, method)
+	case *ASTUnaryExpr:
+		p.analyzeUnaryExpr(n, method)
+	case *ASTCastExpr:
+		p.analyzeCastExpr(n, method)
+	case *ASTFieldExpr:
+		p.analyzeFieldExpr(n, method)
+	case *ASTInvokeExpr:
+		p.analyzeInvokeExpr(n, method)
+	case *ASTFieldAssign:
+		p.analyzeFieldAssign(n, method)
+	case *ASTConstDecl, *ASTGlobalDecl:
+		// Defined before the rest of the program is analyzed
 	default:
 		panic(fmt.Sprintf("No function to walk node: %T", node))
 	}
 }
 
 func (a *AnalyzedProgram) analyzeTrigger(n *ASTTrigger) {
-	var trigger Trigger
-	trigger.name = n.trigger
-
 	// Resolve the trigger uid
-	listener := a.runtime.FindListener(trigger.name)
+	listener := a.runtime.FindListener(n.trigger)
 	if listener == nil {
-		panic(fmt.Errorf("unknown trigger %s, not defined in runtime", trigger.name))
+		a.error(ErrUnknownTrigger, n.Span, "unknown trigger %s, not defined in runtime", n.trigger)
+	}
+
+	// Verify the filter values against the listener parameters, converting them to the values in the trigger table
+	filters := make([][]interface{}, len(n.filters))
+	names := make([]string, len(n.filters))
+	for i, alternatives := range n.filters {
+		var texts []string
+		for _, v := range alternatives {
+			literal := a.constantValue(v)
+			if literal == nil {
+				continue
+			}
+
+			value := a.triggerValue(listener, i, literal)
+			filters[i] = append(filters[i], value)
+			texts = append(texts, formatFilterValue(value))
+		}
+
+		names[i] = strings.Join(texts, "|")
 	}
 
-	trigger.definition = listener
-	n.entry = &trigger
+	if listener != nil && len(n.filters)+len(n.bound) > len(listener.Parameters) {
+		a.error(ErrInvalidTriggerValue, n.Span, "too many parameters for %s, it takes %d", n.trigger, len(listener.Parameters))
+	}
 
-	// Verify that the filter value is a valid value.
-	// For now, values are longs only. This is subject to change.
-	parsed, err := strconv.ParseUint(n.value, 10, 64)
-	if err != nil {
-		panic(fmt.Errorf("cannot parse trigger value into long: %s", n.value))
+	if listener != nil && len(n.arguments) > len(listener.Arguments) {
+		a.error(ErrInvalidTriggerValue, n.Span, "too many arguments for %s, it delivers %d", n.trigger, len(listener.Arguments))
 	}
 
-	n.method = a.defineMethod("@" + n.trigger + "@" + n.value + "@" + strconv.Itoa(a.triggerIndex))
-	trigger.label = n.method.entry
+	n.method = a.defineMethod("@" + n.trigger + "@" + strings.Join(names, ",") + "@" + strconv.Itoa(a.triggerIndex))
 	a.triggerIndex++
 
-	trigger.values = []interface{}{int64(parsed)} // TODO All value types here.
+	// The event values are the first locals of the trigger: the listener parameters followed by its arguments. The
+	// ones that are not bound get a name that cannot be referenced from a script.
+	if listener != nil {
+		for i, param := range listener.Parameters {
+			if j := i - len(n.filters); j >= 0 && j < len(n.bound) {
+				a.bindEventValue(n, n.bound[j], param)
+			} else {
+				n.method.defineVariable("@"+param.Name, param.Type)
+			}
+		}
+
+		for i, param := range listener.Arguments {
+			if i < len(n.arguments) {
+				a.bindEventValue(n, n.arguments[i], param)
+			} else {
+				n.method.defineVariable("@"+param.Name, param.Type)
+			}
+		}
+	}
+
+	// Alternatives are compiled into a trigger table entry for every combination, all starting the same code
+	combinations := [][]interface{}{{}}
+	for _, alternatives := range filters {
+		var next [][]interface{}
+		for _, prefix := range combinations {
+			for _, v := range alternatives {
+				next = append(next, append(append([]interface{}{}, prefix...), v))
+			}
+		}
+		combinations = next
+	}
+
+	for _, values := range combinations {
+		trigger := &Trigger{
+			name:       n.trigger,
+			definition: listener,
+			label:      n.method.entry,
+			values:     values,
+		}
 
-	a.triggers = append(a.triggers, &trigger)
+		n.entries = append(n.entries, trigger)
+		if listener != nil {
+			a.triggers = append(a.triggers, trigger)
+		}
+	}
 
 	// Assemble the code belonging to this call
 	a.analyzeNode(n.statement, n.method)
 }
 
+// bindEventValue defines the local for a listener parameter or argument that is bound in a trigger declaration.
+func (a *AnalyzedProgram) bindEventValue(n *ASTTrigger, binding FuncArgument, param FunctionParameter) {
+	vt := a.resolveVarType(binding.argtype)
+	if vt == VarTypeUnresolved {
+		a.error(ErrUnresolvedType, binding.span, "unresolved variable type %s", binding.argtype)
+	} else if vt != param.Type {
+		a.error(ErrTypeMismatch, binding.span, "%s delivers %s as %s, cannot bind it as %s", n.trigger, param.Name, param.Type.String(), vt.String())
+	}
+
+	if n.method.resolveVariable(binding.name) != nil {
+		a.error(ErrRedeclaredVariable, binding.span, "variable redeclared: %s", binding.name)
+	}
+
+	n.method.defineVariable(binding.name, param.Type)
+}
+
+// triggerValue converts a literal filter value to the value stored in the trigger table for the listener parameter at
+// the given position: an int, int64 or string, or a Glob for strings containing wildcards.
+func (a *AnalyzedProgram) triggerValue(listener *RuntimeListener, position int, literal *ASTLiteralExpr) interface{} {
+	if listener == nil || position >= len(listener.Parameters) {
+		return literal.value
+	}
+
+	param := listener.Parameters[position]
+	switch {
+	case param.Type == VarTypeInt && literal.literalType == LiteralInteger:
+		return literal.value
+	case param.Type == VarTypeLong && literal.literalType == LiteralInteger:
+		return int64(literal.value.(int))
+	case param.Type == VarTypeLong && literal.literalType == LiteralLong:
+		return literal.value
+	case param.Type == VarTypeString && literal.literalType == LiteralString:
+		if value := literal.value.(string); strings.ContainsAny(value, "*?") {
+			return Glob(value)
+		}
+		return literal.value
+	case param.Type != VarTypeInt && param.Type != VarTypeLong && param.Type != VarTypeString:
+		a.error(ErrInvalidTriggerValue, literal.Span, "cannot filter on parameter %s of type %s, only int, long and string parameters can be filtered", param.Name, param.Type.String())
+	default:
+		a.error(ErrInvalidTriggerValue, literal.Span, "filter value %s does not match parameter %s of type %s", formatFilterValue(literal.value), param.Name, param.Type.String())
+	}
+
+	return literal.value
+}
+
+// formatFilterValue formats a trigger filter value the way it is written in a script.
+func formatFilterValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case Glob:
+		return strconv.Quote(string(v))
+	case float64:
+		return formatFloat(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 func (a *AnalyzedProgram) analyzeFunc(n *ASTFunc) {
-	m := a.resolveMethod(n.name)
-	a.analyzeNode(n.body, m)
+	a.analyzeNode(n.body, n.method)
+
+	// Every path through a function with a return type has to end in a return statement
+	if n.method.returnType != VarTypeVoid && n.method.returnType != VarTypeUnresolved && !alwaysReturns(n.body) {
+		a.error(ErrMissingReturn, n.Span, "missing return statement in function %s, which returns %s", n.name, n.method.returnType.String())
+	}
 }
 
 func (a *AnalyzedProgram) analyzeBlock(n *ASTBlockStatement, m *Method) {
+	scope := len(m.scope)
+
 	for _, v := range n.statements {
 		a.analyzeNode(v, m)
 	}
+
+	m.scope = m.scope[:scope]
 }
 
 func (a *AnalyzedProgram) analyzeIfStatement(n *ASTIfStmt, m *Method) {
-	a.analyzeNode(n.condition, m)
+	a.analyzeCondition(n.condition, m)
 
 	a.analyzeNode(n.ifTrue, m)
 
@@ -151,16 +363,128 @@ func (a *AnalyzedProgram) analyzeIfStatement(n *ASTIfStmt, m *Method) {
 	}
 }
 
+func (a *AnalyzedProgram) analyzeWhileStmt(n *ASTWhileStmt, m *Method) {
+	a.analyzeCondition(n.condition, m)
+
+	m.loopDepth++
+	a.analyzeNode(n.body, m)
+	m.loopDepth--
+}
+
+func (a *AnalyzedProgram) analyzeForStmt(n *ASTForStmt, m *Method) {
+	// A variable declared in the initializer is only visible inside the loop
+	scope := len(m.scope)
+
+	if n.init != nil {
+		a.analyzeNode(n.init, m)
+	}
+
+	if n.condition != nil {
+		a.analyzeCondition(n.condition, m)
+	}
+
+	if n.post != nil {
+		a.analyzeNode(n.post, m)
+	}
+
+	m.loopDepth++
+	a.analyzeNode(n.body, m)
+	m.loopDepth--
+
+	m.scope = m.scope[:scope]
+}
+
+// analyzeCondition analyzes the condition of an if statement or loop, which has to be a bool.
+func (a *AnalyzedProgram) analyzeCondition(n ASTNode, m *Method) {
+	a.analyzeNode(n, m)
+
+	if t := m.TypeOfNode(n); !typesCompatible(t, VarTypeBool) {
+		a.error(ErrTypeMismatch, n.Position(), "condition must be a bool, got %s", t.String())
+	}
+}
+
+func (a *AnalyzedProgram) analyzeBranchStmt(span Span, keyword string, m *Method) {
+	if m.loopDepth == 0 {
+		a.error(ErrBranchOutsideLoop, span, "%s outside of a loop", keyword)
+	}
+}
+
+func (a *AnalyzedProgram) analyzeReturnStmt(n *ASTReturnStmt, m *Method) {
+	if n.value == nil {
+		if m.returnType != VarTypeVoid && m.returnType != VarTypeUnresolved {
+			a.error(ErrTypeMismatch, n.Span, "missing return value, function %s returns %s", m.name, m.returnType.String())
+		}
+		return
+	}
+
+	a.analyzeNode(n.value, m)
+
+	if m.returnType == VarTypeVoid {
+		a.error(ErrTypeMismatch, n.value.Position(), "cannot return a value from %s, which does not return anything", m.displayName())
+		return
+	}
+
+	exprType := m.TypeOfNode(n.value)
+	n.value = a.convertValue(n.value, m.returnType, m, "cannot return value of type '%s' from function %s, which returns %s", exprType.String(), m.name, m.returnType.String())
+}
+
+// alwaysReturns checks whether execution of the statement never continues past it, because every path through it
+// ends in a return statement or an infinite loop.
+func alwaysReturns(node ASTNode) bool {
+	switch n := node.(type) {
+	case *ASTReturnStmt:
+		return true
+	case *ASTBlockStatement:
+		for _, v := range n.statements {
+			if alwaysReturns(v) {
+				return true
+			}
+		}
+	case *ASTIfStmt:
+		return n.ifFalse != nil && alwaysReturns(n.ifTrue) && alwaysReturns(n.ifFalse)
+	case *ASTWhileStmt:
+		return isTrueLiteral(n.condition) && !breaksLoop(n.body)
+	case *ASTForStmt:
+		return (n.condition == nil || isTrueLiteral(n.condition)) && !breaksLoop(n.body)
+	}
+
+	return false
+}
+
+// breaksLoop checks whether the statement contains a break for the loop it is the body of. Breaks in nested loops
+// belong to those loops and are not counted.
+func breaksLoop(node ASTNode) bool {
+	switch n := node.(type) {
+	case *ASTBreakStmt:
+		return true
+	case *ASTBlockStatement:
+		for _, v := range n.statements {
+			if breaksLoop(v) {
+				return true
+			}
+		}
+	case *ASTIfStmt:
+		return breaksLoop(n.ifTrue) || (n.ifFalse != nil && breaksLoop(n.ifFalse))
+	}
+
+	return false
+}
+
+func isTrueLiteral(node ASTNode) bool {
+	literal, ok := node.(*ASTLiteralExpr)
+	return ok && literal.literalType == LiteralBoolean && literal.value == true
+}
+
 func (a *AnalyzedProgram) analyzeVarDecl(n *ASTVarDeclaration, m *Method) {
-	var vartype = ResolveVarType(n.varType)
+	var vartype = a.resolveVarType(n.varType)
 
 	if vartype == VarTypeUnresolved {
-		panic("unresolved variable type: " + n.varType)
+		a.error(ErrUnresolvedType, n.Span, "unresolved variable type: %s", n.varType)
 	}
 
 	// See if this variable is already defined...
 	if m.resolveVariable(n.varName) != nil {
-		panic("variable redeclared: " + n.varName)
+		a.error(ErrRedeclaredVariable, n.Span, "variable redeclared: %s", n.varName)
 	}
 
 	n.variable = m.defineVariable(n.varName, vartype)
@@ -172,15 +496,107 @@ func (a *AnalyzedProgram) analyzeVarDecl(n *ASTVarDeclaration, m *Method) {
 
 		// Now verify that type against the variable type
 		exprType := m.TypeOfNode(n.varValue)
+		n.varValue = a.convertValue(n.varValue, vartype, m, "cannot assign value of type '%s' to '%s %s'", exprType.String(), n.varType, n.varName)
+	} else if isPrimitive(vartype) {
+		// A variable declared without a value starts out as the zero value of its type
+		n.varValue = zeroLiteral(n.Span, vartype)
+	} else if vartype != VarTypeUnresolved {
+		a.error(ErrUninitializedVariable, n.Span, "variable %s has to be given a value, as %s has no zero value", n.varName, vartype.String())
+	}
+}
 
-		// Verify types
-		if exprType != vartype {
-			panic("cannot assign value of type '" + exprType.String() + "' to '" + n.varType + " " + n.varName + "'")
-		}
+func (a *AnalyzedProgram) analyzeVarAssign(n *ASTVarAssign, m *Method) {
+	n.variable = m.resolveVariable(n.varName)
+	if n.variable == nil {
+		n.global = a.resolveGlobal(n.varName)
+	}
+
+	if n.variable == nil && n.global == nil && a.constants[n.varName] != nil {
+		a.error(ErrAssignToConstant, n.Span, "cannot assign to constant %s", n.varName)
+	} else if n.variable == nil && n.global == nil {
+		a.error(ErrUndefinedVariable, n.Span, "undefined variable: %s", n.varName)
+	}
+
+	a.analyzeNode(n.varValue, m)
+
+	varType := VarTypeUnresolved
+	if n.variable != nil {
+		varType = n.variable.typ
+	} else if n.global != nil {
+		varType = n.global.typ
 	}
+
+	exprType := m.TypeOfNode(n.varValue)
+	n.varValue = a.convertValue(n.varValue, varType, m, "assigning wrong type to '%s %s' (passed: %s)", varType.String(), n.varName, exprType.String())
+}
+
+// typesCompatible checks whether a value of one type can be used where the other is expected. Unresolved types are
+// compatible with anything, since an error has already been reported for them.
+func typesCompatible(actual VariableType, expected VariableType) bool {
+	return actual == expected || actual == VarTypeUnresolved || expected == VarTypeUnresolved
+}
+
+// canWiden checks whether values of one type are converted implicitly where the other is expected. Only conversions
+// that never lose information are implicit: int to long and int to float.
+func canWiden(actual VariableType, expected VariableType) bool {
+	return actual == VarTypeInt && (expected == VarTypeLong || expected == VarTypeFloat)
+}
+
+// assignable checks whether a value of one type can be used where the other is expected, either as it is or widened.
+func assignable(actual VariableType, expected VariableType) bool {
+	return typesCompatible(actual, expected) || canWiden(actual, expected)
+}
+
+// widen converts the value of the node to the expected type if it has to be widened. Literals are converted right
+// away, other values are wrapped in a cast.
+func (m *Method) widen(node ASTNode, expected VariableType) ASTNode {
+	if !canWiden(m.TypeOfNode(node), expected) {
+		return node
+	}
+
+	if literal, ok := node.(*ASTLiteralExpr); ok {
+		return widenLiteral(literal, expected)
+	}
+
+	cast := newCastExpr(node.Position(), expected.String(), node)
+	cast.typ = expected
+	return cast
+}
+
+// widenLiteral converts an int literal to a long or float literal.
+func widenLiteral(literal *ASTLiteralExpr, expected VariableType) *ASTLiteralExpr {
+	if expected == VarTypeFloat {
+		return newLiteral(literal.Span, LiteralFloat, float64(literal.value.(int)))
+	}
+
+	return newLiteral(literal.Span, LiteralLong, int64(literal.value.(int)))
+}
+
+// convertValue checks a value against the type it is stored as, and returns the node to store, widened if needed. A
+// number that would have to be narrowed is reported as needing a cast, other mismatches with the given message.
+func (a *AnalyzedProgram) convertValue(node ASTNode, expected VariableType, m *Method, format string, args ...interface{}) ASTNode {
+	actual := m.TypeOfNode(node)
+	if typesCompatible(actual, expected) {
+		return node
+	} else if canWiden(actual, expected) {
+		return m.widen(node, expected)
+	}
+
+	if isNumeric(actual) && isNumeric(expected) {
+		a.error(ErrNarrowingConversion, node.Position(), "cannot convert %s to %s implicitly, use a cast: (%s)", actual.String(), expected.String(), expected.String())
+	} else {
+		a.error(ErrTypeMismatch, node.Position(), format, args...)
+	}
+
+	return node
 }
 
 func (a *AnalyzedProgram) analyzeMethodExpr(n *ASTMethodExpr, m *Method) {
+	// Analyze method parameters first, so their types can be resolved
+	for i := range n.parameters {
+		a.analyzeNode(n.parameters[len(n.parameters)-i-1], m)
+	}
+
 	// Form list of argument types
 	var types []VariableType
 	for _, v := range n.parameters {
@@ -188,41 +604,421 @@ func (a *AnalyzedProgram) analyzeMethodExpr(n *ASTMethodExpr, m *Method) {
 	}
 
 	// See if this is a native method first. Likelihood is much greater.
-	nativeMethod := a.runtime.FindFunctionWithArguments(n.name, types...)
+	nativeMethod := a.findNativeFunction(n.name, types)
 	var localMethod *Method
 
 	if nativeMethod == nil {
 		localMethod = a.resolveMethod(n.name)
 
-		// Still not found? Panic.
+		// Still not found? Report it, unless an argument already failed to resolve.
 		if localMethod == nil {
+			for _, t := range types {
+				if t == VarTypeUnresolved {
+					return
+				}
+			}
+
 			params := "(" + TypeListToString(", ", types...) + ")"
-			panic("Cannot resolve local or native method: " + n.name + params)
+			a.error(ErrUnresolvedMethod, n.Span, "cannot resolve local or native method: %s%s", n.name, params)
+			return
 		}
-	}
 
-	// Analyze method parameters
-	for i := range n.parameters {
-		a.analyzeNode(n.parameters[len(n.parameters)-i-1], m)
+		// Arguments are stored straight into the parameters of the function, so they have to match them or be widened
+		matches := len(localMethod.arguments) == len(types)
+		for i := 0; matches && i < len(types); i++ {
+			matches = assignable(types[i], localMethod.arguments[i].typ)
+		}
+
+		if !matches {
+			var expected []VariableType
+			for _, v := range localMethod.arguments {
+				expected = append(expected, v.typ)
+			}
+
+			a.error(ErrUnresolvedMethod, n.Span, "cannot call %s(%s) with (%s)", n.name, TypeListToString(", ", expected...), TypeListToString(", ", types...))
+			return
+		}
 	}
 
 	if nativeMethod != nil {
 		n.native = nativeMethod
+		n.suspends = nativeMethod.Suspending
+
+		for i, v := range nativeMethod.Parameters {
+			n.parameters[i] = m.widen(n.parameters[i], v.Type)
+		}
 	} else {
 		n.local = localMethod
+
+		for i, v := range localMethod.arguments {
+			n.parameters[i] = m.widen(n.parameters[i], v.typ)
+		}
+	}
+}
+
+// findNativeFunction finds the native function a call refers to. A function taking exactly the types of the arguments
+// is preferred, otherwise the first one that takes them once widened is used.
+func (a *AnalyzedProgram) findNativeFunction(name string, types []VariableType) *RuntimeFunction {
+	if fn := a.runtime.FindFunctionWithArguments(name, types...); fn != nil {
+		return fn
+	}
+
+functions:
+	for _, v := range a.runtime.Functions {
+		if v.Name != name || len(v.Parameters) != len(types) {
+			continue
+		}
+
+		for i, param := range v.Parameters {
+			if !canWiden(types[i], param.Type) && types[i] != param.Type {
+				continue functions
+			}
+		}
+
+		return v
+	}
+
+	return nil
+}
+
+// resolveReceiverType finds the native type declaring the members of the receiver. Members can only be accessed on
+// values of a native<T> type that the runtime declares.
+func (a *AnalyzedProgram) resolveReceiverType(receiver ASTNode, member string, m *Method) *BaseType {
+	t := m.TypeOfNode(receiver)
+	if t == VarTypeUnresolved {
+		return nil
+	}
+
+	if t.keyword != "native" {
+		a.error(ErrUnknownMember, receiver.Position(), "cannot access member %s of %s, only native types have members", member, t.String())
+		return nil
+	}
+
+	typ := a.runtime.FindType(t.native)
+	if typ == nil {
+		a.error(ErrUnresolvedType, receiver.Position(), "native type %s is not declared in the runtime", t.native)
+	}
+
+	return typ
+}
+
+func (a *AnalyzedProgram) analyzeFieldExpr(n *ASTFieldExpr, m *Method) {
+	a.analyzeNode(n.receiver, m)
+
+	typ := a.resolveReceiverType(n.receiver, n.name, m)
+	if typ == nil {
+		return
+	}
+
+	n.field = typ.ResolveField(n.name)
+	if n.field == nil {
+		a.error(ErrUnknownMember, n.Span, "type %s has no field %s", typ.Name, n.name)
+	}
+}
+
+func (a *AnalyzedProgram) analyzeFieldAssign(n *ASTFieldAssign, m *Method) {
+	a.analyzeNode(n.target, m)
+	a.analyzeNode(n.value, m)
+
+	if n.target.field == nil {
+		return
+	}
+
+	if n.target.field.ReadOnly {
+		a.error(ErrReadOnlyField, n.target.Span, "cannot assign to read-only field %s", n.target.name)
+	}
+
+	exprType := m.TypeOfNode(n.value)
+	n.value = a.convertValue(n.value, n.target.field.Type, m, "cannot assign value of type '%s' to field %s of type %s", exprType.String(), n.target.name, n.target.field.Type.String())
+}
+
+func (a *AnalyzedProgram) analyzeInvokeExpr(n *ASTInvokeExpr, m *Method) {
+	a.analyzeNode(n.receiver, m)
+
+	var types []VariableType
+	for _, v := range n.parameters {
+		a.analyzeNode(v, m)
+		types = append(types, m.TypeOfNode(v))
+	}
+
+	typ := a.resolveReceiverType(n.receiver, n.name, m)
+	if typ == nil {
+		return
+	}
+
+	method := typ.ResolveMethod(n.name)
+	if method == nil {
+		a.error(ErrUnknownMember, n.Span, "type %s has no method %s", typ.Name, n.name)
+		return
+	}
+
+	matches := len(method.Parameters) == len(types)
+	for i := 0; matches && i < len(types); i++ {
+		matches = assignable(types[i], method.Parameters[i].Type)
+	}
+
+	if !matches {
+		var expected []VariableType
+		for _, v := range method.Parameters {
+			expected = append(expected, v.Type)
+		}
+
+		a.error(ErrUnresolvedMethod, n.Span, "cannot call %s.%s(%s) with (%s)", typ.Name, n.name, TypeListToString(", ", expected...), TypeListToString(", ", types...))
+		return
+	}
+
+	n.method = method
+	for i, v := range method.Parameters {
+		n.parameters[i] = m.widen(n.parameters[i], v.Type)
 	}
 }
 
 func (a *AnalyzedProgram) analyzeLogicalExpr(n *ASTLogicalExpr, m *Method) {
 	a.analyzeNode(n.left, m)
 	a.analyzeNode(n.right, m)
+
+	switch n.comparator {
+	case tokenEqual, tokenNotEqual, tokenPlus, tokenMinus, tokenMultiply, tokenDivide, tokenModulo:
+	case tokenLessThan, tokenLessOrEqual, tokenGreaterThan, tokenGreaterOrEqual:
+	case tokenAnd, tokenOr:
+		// Both sides of a logical operator are conditions
+		for _, operand := range []ASTNode{n.left, n.right} {
+			if t := m.TypeOfNode(operand); !typesCompatible(t, VarTypeBool) {
+				a.error(ErrTypeMismatch, operand.Position(), "operator '%s' expects bool operands, got %s", tokenNames[n.comparator], t.String())
+			}
+		}
+		return
+	default:
+		a.error(ErrUnsupportedOperator, n.Span, "operator '%s' is not supported", tokenNames[n.comparator])
+		return
+	}
+
+	// Adding anything to a string converts it to text
+	if n.comparator == tokenPlus && m.TypeOfNode(n) == VarTypeString {
+		for _, operand := range []ASTNode{n.left, n.right} {
+			if t := m.TypeOfNode(operand); t != VarTypeUnresolved && !isPrimitive(t) {
+				a.error(ErrTypeMismatch, operand.Position(), "cannot add %s to a string, only ints, longs, floats and bools can be converted to text", t.String())
+			}
+		}
+		return
+	}
+
+	// An int operand is widened to the type of the other one
+	n.left = m.widen(n.left, m.TypeOfNode(n.right))
+	n.right = m.widen(n.right, m.TypeOfNode(n.left))
+
+	left := m.TypeOfNode(n.left)
+	right := m.TypeOfNode(n.right)
+	if !typesCompatible(left, right) && isNumeric(left) && isNumeric(right) {
+		a.error(ErrNarrowingConversion, n.Span, "cannot compute value of %s and %s, cast one of them to the type of the other", left.String(), right.String())
+		return
+	} else if !typesCompatible(left, right) {
+		a.error(ErrTypeMismatch, n.Span, "cannot compute value of %s and %s", left.String(), right.String())
+		return
+	}
+
+	// Only equality applies to every type, the other operators need numbers
+	if n.comparator != tokenEqual && n.comparator != tokenNotEqual && !isNumeric(left) && left != VarTypeUnresolved {
+		a.error(ErrTypeMismatch, n.Span, "operator '%s' cannot be applied to %s", tokenNames[n.comparator], left.String())
+	}
+}
+
+func (a *AnalyzedProgram) analyzeUnaryExpr(n *ASTUnaryExpr, m *Method) {
+	a.analyzeNode(n.operand, m)
+
+	t := m.TypeOfNode(n.operand)
+	if t == VarTypeUnresolved {
+		return
+	}
+
+	if n.operator == tokenNot && t != VarTypeBool {
+		a.error(ErrTypeMismatch, n.Span, "operator '!' cannot be applied to %s", t.String())
+	} else if n.operator == tokenMinus && !isNumeric(t) {
+		a.error(ErrTypeMismatch, n.Span, "operator '-' cannot be applied to %s", t.String())
+	}
+}
+
+func (a *AnalyzedProgram) analyzeCastExpr(n *ASTCastExpr, m *Method) {
+	a.analyzeNode(n.operand, m)
+	n.typ = a.resolveVarType(n.typeName)
+
+	if t := m.TypeOfNode(n.operand); t != VarTypeUnresolved && !isNumeric(t) {
+		a.error(ErrTypeMismatch, n.Span, "cannot cast %s to %s, only numbers can be cast", t.String(), n.typeName)
+	}
+}
+
+func isNumeric(t VariableType) bool {
+	return t == VarTypeInt || t == VarTypeLong || t == VarTypeFloat
+}
+
+// isComparison checks whether the operator compares its operands, producing a bool.
+func isComparison(t tokenType) bool {
+	return isEqualityOperator(t) || isRelationalOperator(t)
 }
 
 func (a *AnalyzedProgram) analyzeIdentifierExpr(n *ASTIdentifierExpr, m *Method) {
-	//TODO type checks
+	// Locals shadow globals, which in turn shadow constants of the same name
 	n.resolved = m.resolveVariable(n.identifier)
 	if n.resolved == nil {
-		panic("undefined variable: " + n.identifier)
+		n.global = a.resolveGlobal(n.identifier)
+	}
+
+	if n.resolved == nil && n.global == nil {
+		n.constant = a.constants[n.identifier]
+	}
+
+	if n.resolved == nil && n.global == nil && n.constant == nil {
+		a.error(ErrUndefinedVariable, n.Span, "undefined variable: %s", n.identifier)
+	}
+}
+
+// defineConst defines a constant declared in the script. Its value is stored as a literal of the declared type, which
+// is compiled in place of every use of the constant.
+func (a *AnalyzedProgram) defineConst(n *ASTConstDecl) {
+	if _, ok := a.constants[n.name]; ok {
+		a.error(ErrRedeclaredVariable, n.Span, "constant redeclared: %s", n.name)
+		return
+	}
+
+	vt := a.resolveVarType(n.varType)
+	if vt == VarTypeUnresolved {
+		a.error(ErrUnresolvedType, n.Span, "unresolved variable type: %s", n.varType)
+		return
+	} else if !isPrimitive(vt) {
+		a.error(ErrTypeMismatch, n.Span, "constant %s cannot be of type %s, it has to be one of: %s", n.name, vt.String(), TypeListToString(", ", primitiveTypes...))
+		return
+	}
+
+	if literal := a.constantOfType(n.value, vt, "const "+vt.String()+" "+n.name); literal != nil {
+		a.constants[n.name] = literal
+	}
+}
+
+// defineGlobal defines a variable declared at the top level of the script.
+func (a *AnalyzedProgram) defineGlobal(n *ASTGlobalDecl) {
+	if a.resolveGlobal(n.name) != nil {
+		a.error(ErrRedeclaredVariable, n.Span, "variable redeclared: %s", n.name)
+		return
+	}
+
+	vt := a.resolveVarType(n.varType)
+	if vt == VarTypeUnresolved {
+		a.error(ErrUnresolvedType, n.Span, "unresolved variable type: %s", n.varType)
+		return
+	} else if !isPrimitive(vt) {
+		a.error(ErrTypeMismatch, n.Span, "global %s cannot be of type %s, it has to be one of: %s", n.name, vt.String(), TypeListToString(", ", primitiveTypes...))
+		return
+	}
+
+	// The global is defined even if its value is invalid, so its uses don't report errors of their own
+	value := zeroLiteral(n.Span, vt)
+	if n.value != nil {
+		if literal := a.constantOfType(n.value, vt, vt.String()+" "+n.name); literal != nil {
+			value = literal
+		}
+	}
+
+	n.global = &GlobalVariable{
+		index:   len(a.globals),
+		name:    n.name,
+		typ:     vt,
+		persist: n.persist,
+		value:   value,
+	}
+	a.globals = append(a.globals, n.global)
+}
+
+func (a *AnalyzedProgram) resolveGlobal(name string) *GlobalVariable {
+	for _, v := range a.globals {
+		if v.name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// primitiveTypes holds the types whose values can be written as a literal, which constants and globals can have.
+var primitiveTypes = []VariableType{VarTypeInt, VarTypeLong, VarTypeFloat, VarTypeString, VarTypeBool}
+
+// isPrimitive checks whether values of the type can be written as a literal.
+func isPrimitive(t VariableType) bool {
+	for _, v := range primitiveTypes {
+		if v == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// constantOfType returns the literal a compile-time value stands for, checked against the type of the declaration it
+// is assigned to. An int value is widened for long and float declarations.
+func (a *AnalyzedProgram) constantOfType(node ASTNode, vt VariableType, declaration string) *ASTLiteralExpr {
+	literal := a.constantValue(node)
+	if literal == nil {
+		return nil
+	}
+
+	if canWiden(LiteralToVarType(literal.literalType), vt) {
+		literal = widenLiteral(literal, vt)
+	}
+
+	if valueType := LiteralToVarType(literal.literalType); valueType != vt {
+		a.error(ErrTypeMismatch, node.Position(), "assigning wrong type to '%s' (passed: %s)", declaration, valueType.String())
+		return nil
+	}
+
+	return literal
+}
+
+// zeroLiteral returns the value of a primitive type that variables and globals declared without a value start with.
+func zeroLiteral(span Span, vt VariableType) *ASTLiteralExpr {
+	switch vt {
+	case VarTypeLong:
+		return newLiteral(span, LiteralLong, int64(0))
+	case VarTypeFloat:
+		return newLiteral(span, LiteralFloat, float64(0))
+	case VarTypeString:
+		return newLiteral(span, LiteralString, "")
+	case VarTypeBool:
+		return newLiteral(span, LiteralBoolean, false)
+	default:
+		return newLiteral(span, LiteralInteger, 0)
+	}
+}
+
+// constantValue returns the literal a compile-time value stands for: the literal itself, or the value of the named
+// constant. Unknown constants are reported, and nil is returned for them.
+func (a *AnalyzedProgram) constantValue(node ASTNode) *ASTLiteralExpr {
+	switch n := node.(type) {
+	case *ASTLiteralExpr:
+		return n
+	case *ASTIdentifierExpr:
+		if constant, ok := a.constants[n.identifier]; ok {
+			// Errors about the value should point at its use
+			return newLiteral(n.Span, constant.literalType, constant.value)
+		}
+
+		a.error(ErrUndefinedVariable, n.Span, "undefined constant: %s", n.identifier)
+	}
+
+	return nil
+}
+
+// literalOf creates a literal for a constant value of the runtime.
+func literalOf(span Span, value interface{}) *ASTLiteralExpr {
+	switch value.(type) {
+	case int64:
+		return newLiteral(span, LiteralLong, value)
+	case float64:
+		return newLiteral(span, LiteralFloat, value)
+	case string:
+		return newLiteral(span, LiteralString, value)
+	case bool:
+		return newLiteral(span, LiteralBoolean, value)
+	default:
+		return newLiteral(span, LiteralInteger, value)
 	}
 }
 
@@ -233,10 +1029,12 @@ func (a *AnalyzedProgram) analyzeLiteralExpr(n *ASTLiteralExpr, m *Method) {
 
 	} else if n.literalType == LiteralLong {
 
+	} else if n.literalType == LiteralFloat {
+
 	} else if n.literalType == LiteralBoolean {
 
 	} else {
-		panic(fmt.Sprintf("unknown literal type %d (value %s)", n.literalType, n.value))
+		a.error(ErrInternal, n.Span, "unknown literal type %d (value %v)", n.literalType, n.value)
 	}
 }
 
@@ -257,6 +1055,7 @@ func (p *AnalyzedProgram) defineMethod(name string) *Method {
 	method := &Method{
 		name:         name,
 		index:        index,
+		returnType:   VarTypeVoid,
 		instructions: make([]*Instruction, 512)[:0],
 		variables:    make([]*LocalVariable, 4)[:0],
 	}
@@ -271,8 +1070,18 @@ func (p *AnalyzedProgram) defineMethod(name string) *Method {
 	return method
 }
 
+// displayName returns how the method is referred to in error messages. Triggers are compiled into methods with a
+// generated name starting with '@'.
+func (m *Method) displayName() string {
+	if strings.HasPrefix(m.name, "@") {
+		return "trigger " + strings.Split(m.name, "@")[1]
+	}
+
+	return "function " + m.name
+}
+
 func (m *Method) resolveVariable(name string) *LocalVariable {
-	for _, v := range m.variables {
+	for _, v := range m.scope {
 		if v.name == name {
 			return v
 		}
@@ -292,23 +1101,33 @@ func (a *Method) defineVariable(name string, t VariableType) *LocalVariable {
 	}
 
 	a.variables = append(a.variables, local)
+	a.scope = append(a.scope, local)
 	return local
 }
 
 func (p *AnalyzedProgram) defineFunc(n *ASTFunc) {
 	method := p.resolveMethod(n.name)
 	if method != nil {
-		panic(fmt.Sprintf("redefining function: %s", n.name))
+		p.error(ErrRedefinedFunction, n.Span, "redefining function: %s", n.name)
 	}
 
 	method = p.defineMethod(n.name)
+	n.method = method
+
+	method.returnType = p.resolveVarType(n.returnType)
+	if n.returnType == "void" {
+		method.returnType = VarTypeVoid
+	}
+	if method.returnType == VarTypeUnresolved {
+		p.error(ErrUnresolvedType, n.Span, "unresolved return type %s", n.returnType)
+	}
 
 	// Define method parameters as local variables
 	for _, arg := range n.arguments {
-		var vt = ResolveVarType(arg.argtype)
+		var vt = p.resolveVarType(arg.argtype)
 
 		if vt == VarTypeUnresolved {
-			panic(fmt.Sprintf("unresolved variable type %s", arg.argtype))
+			p.error(ErrUnresolvedType, arg.span, "unresolved variable type %s", arg.argtype)
 		}
 
 		lv := method.defineVariable(arg.name, vt)
@@ -316,12 +1135,25 @@ func (p *AnalyzedProgram) defineFunc(n *ASTFunc) {
 	}
 }
 
+// resolveVarType resolves a type name used in a script. Besides the builtin types and native<T>, the name of a native
+// type declared in the runtime can be used by itself.
+func (p *AnalyzedProgram) resolveVarType(varType string) VariableType {
+	resolved := ResolveVarType(varType)
+	if resolved == VarTypeUnresolved && p.runtime.FindType(varType) != nil {
+		return VariableType{builtin: false, keyword: "native", native: varType}
+	}
+
+	return resolved
+}
+
 func ResolveVarType(varType string) VariableType {
 	switch varType {
 	case "int":
 		return VarTypeInt
 	case "long":
 		return VarTypeLong
+	case "float":
+		return VarTypeFloat
 	case "string":
 		return VarTypeString
 	case "bool":
@@ -351,38 +1183,58 @@ func (m *Method) TypeOfNode(node ASTNode) VariableType {
 			return VarTypeInt
 		} else if t.literalType == LiteralLong {
 			return VarTypeLong
+		} else if t.literalType == LiteralFloat {
+			return VarTypeFloat
 		} else if t.literalType == LiteralString {
 			return VarTypeString
 		} else if t.literalType == LiteralBoolean {
 			return VarTypeBool
-		} else {
-			panic(fmt.Errorf("cannot resolve type from LiteralExpr, unknown literal type %d", t.literalType))
 		}
 	case *ASTMethodExpr:
 		if t.local != nil {
-			panic("local method return types not supported")
+			return t.local.returnType
 		} else if t.native != nil {
 			return t.native.ReturnType
-		} else {
-			panic("no resolved local/native func: " + t.name)
 		}
 	case *ASTIdentifierExpr:
-		// TODO do this a bit nicer
-		resolved := m.resolveVariable(t.identifier)
-		if resolved == nil {
-			panic("cannot resolve variable " + t.identifier)
+		if t.resolved != nil {
+			return t.resolved.typ
+		} else if t.global != nil {
+			return t.global.typ
+		} else if t.constant != nil {
+			return m.TypeOfNode(t.constant)
 		}
-		return resolved.typ
 	case *ASTLogicalExpr:
 		left := m.TypeOfNode(t.left)
 		right := m.TypeOfNode(t.right)
 
-		if left != right {
-			panic("cannot compute value of " + left.String() + " and " + right.String())
+		if isLogicalOperator(t.comparator) {
+			return VarTypeBool
+		} else if t.comparator == tokenPlus && (left == VarTypeString || right == VarTypeString) {
+			return VarTypeString
+		} else if left == right {
+			if isComparison(t.comparator) {
+				return VarTypeBool
+			}
+			return left
+		}
+	case *ASTUnaryExpr:
+		if t.operator == tokenNot {
+			return VarTypeBool
+		}
+		return m.TypeOfNode(t.operand)
+	case *ASTCastExpr:
+		return t.typ
+	case *ASTFieldExpr:
+		if t.field != nil {
+			return t.field.Type
+		}
+	case *ASTInvokeExpr:
+		if t.method != nil {
+			return t.method.Returns
 		}
-
-		return left
 	}
 
-	panic(fmt.Sprintf("cannot resolve type of node: %T", node))
+	// Anything that failed to resolve has already been reported by the analyzer
+	return VarTypeUnresolved
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConstantAndGlobalTypes(t *testing.T) {
+	script := loadScript(t, `
+const float SPEED = 1.5;
+float distance = SPEED;
+
+on program_start() {
+	distance = distance + SPEED * 2.0;
+	println(distance);
+}
+`)
+
+	if err := script.vm.Dispatch(1); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "4.5")
+
+	for _, source := range []string{
+		"const Handle NOBODY = 0;",
+		"Handle nobody = 0;",
+	} {
+		diagnostics := compileErrors(t, source)
+		if message := diagnostics[0].Message; !strings.HasSuffix(message, "one of: int, long, float, string, bool") {
+			t.Errorf("%s: unexpected message %q", source, message)
+		}
+	}
+}
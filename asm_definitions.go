@@ -17,6 +17,173 @@ const (
 	op_div               = 11
 	op_mul               = 12
 	op_mod               = 13
+	op_yield             = 14
+	op_neq               = 15
+	op_lt                = 16
+	op_le                = 17
+	op_gt                = 18
+	op_ge                = 19
+	op_not               = 20
+	op_neg               = 21
+	op_getfield          = 22
+	op_setfield          = 23
+	op_invoke            = 24
+	op_getglobal         = 25
+	op_setglobal         = 26
+	op_pop               = 27
+	op_i2l               = 28
+	op_i2f               = 29
+	op_l2i               = 30
+	op_l2f               = 31
+	op_f2i               = 32
+	op_f2l               = 33
+	op_concat            = 34
+	op_tostring          = 35
 
 	op_label = 255
 )
+
+var opcodeNames = map[Opcode]string{
+	op_pushconst:  "PUSHCONST",
+	op_jmp:        "JMP",
+	op_getlocal:   "GETLOCAL",
+	op_setlocal:   "SETLOCAL",
+	op_return:     "RETURN",
+	op_jz:         "JZ",
+	op_eq:         "EQ",
+	op_call:       "CALL",
+	op_nativecall: "NATIVECALL",
+	op_add:        "ADD",
+	op_sub:        "SUB",
+	op_div:        "DIV",
+	op_mul:        "MUL",
+	op_mod:        "MOD",
+	op_yield:      "YIELD",
+	op_neq:        "NEQ",
+	op_lt:         "LT",
+	op_le:         "LE",
+	op_gt:         "GT",
+	op_ge:         "GE",
+	op_not:        "NOT",
+	op_neg:        "NEG",
+	op_getfield:   "GETFIELD",
+	op_setfield:   "SETFIELD",
+	op_invoke:     "INVOKE",
+	op_getglobal:  "GETGLOBAL",
+	op_setglobal:  "SETGLOBAL",
+	op_pop:        "POP",
+	op_i2l:        "I2L",
+	op_i2f:        "I2F",
+	op_l2i:        "L2I",
+	op_l2f:        "L2F",
+	op_f2i:        "F2I",
+	op_f2l:        "F2L",
+	op_concat:     "CONCAT",
+	op_tostring:   "TOSTRING",
+}
+
+// Mnemonic returns the assembly name of the opcode as documented in ASSEMBLY.md.
+func (op Opcode) Mnemonic() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+
+	return "UNKNOWN"
+}
+
+// stackEffect returns the number of values the instruction pops off and pushes onto the operand stack. Calls to native
+// functions and methods are looked up in the runtime, and calls to script methods with the given function. The effect
+// is unknown if either one cannot tell.
+func (ins *Instruction) stackEffect(runtime *AdderRuntime, call func(operand int) (int, int, bool)) (pops int, pushes int, known bool) {
+	switch ins.Opcode {
+	case op_pushconst, op_getlocal, op_getglobal:
+		return 0, 1, true
+	case op_setlocal, op_setglobal, op_jz, op_pop:
+		return 1, 0, true
+	case op_eq, op_neq, op_lt, op_le, op_gt, op_ge, op_add, op_sub, op_div, op_mul, op_mod, op_concat:
+		return 2, 1, true
+	case op_not, op_neg, op_getfield, op_i2l, op_i2f, op_l2i, op_l2f, op_f2i, op_f2l, op_tostring:
+		return 1, 1, true
+	case op_setfield:
+		return 2, 0, true
+	case op_nativecall:
+		fn := runtime.FindFunctionById(ins.cpoolIndex)
+		if fn == nil {
+			return 0, 0, false
+		}
+		return len(fn.Parameters), returnedValues(fn.ReturnType), true
+	case op_invoke:
+		_, method := runtime.FindMethodById(ins.cpoolIndex)
+		if method == nil {
+			return 0, 0, false
+		}
+		return len(method.Parameters) + 1, returnedValues(method.Returns), true
+	case op_call:
+		return call(ins.cpoolIndex)
+	case op_jmp, op_return, op_yield:
+		return 0, 0, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// returnedValues returns the number of values a call returning the given type pushes.
+func returnedValues(t VariableType) int {
+	if t == VarTypeVoid {
+		return 0
+	}
+
+	return 1
+}
+
+// tostringTypes holds the types TOSTRING converts to text, by operand. The operands are the value type tags of the
+// binary format, with 5 added for bools, which are ints on the stack.
+var tostringTypes = map[int]VariableType{
+	0: VarTypeInt,
+	1: VarTypeLong,
+	4: VarTypeFloat,
+	5: VarTypeBool,
+}
+
+// tostringOperand returns the operand of the TOSTRING converting values of the given type, if they can be converted.
+func tostringOperand(t VariableType) (int, bool) {
+	for operand, v := range tostringTypes {
+		if v == t {
+			return operand, true
+		}
+	}
+
+	return 0, false
+}
+
+// conversionOp returns the opcode converting a number of one type to another, if there is one.
+func conversionOp(from VariableType, to VariableType) (Opcode, bool) {
+	switch {
+	case from == VarTypeInt && to == VarTypeLong:
+		return op_i2l, true
+	case from == VarTypeInt && to == VarTypeFloat:
+		return op_i2f, true
+	case from == VarTypeLong && to == VarTypeInt:
+		return op_l2i, true
+	case from == VarTypeLong && to == VarTypeFloat:
+		return op_l2f, true
+	case from == VarTypeFloat && to == VarTypeInt:
+		return op_f2i, true
+	case from == VarTypeFloat && to == VarTypeLong:
+		return op_f2l, true
+	}
+
+	return 0, false
+}
+
+// operandSize returns the number of bytes the operand of this opcode occupies in the binary format.
+func (op Opcode) operandSize() int {
+	switch op {
+	case op_pushconst, op_nativecall, op_setlocal, op_getlocal, op_getfield, op_setfield, op_invoke, op_getglobal, op_setglobal, op_tostring:
+		return 2
+	case op_call, op_jz, op_jmp:
+		return 4
+	default:
+		return 0
+	}
+}
@@ -8,6 +8,12 @@ import (
 type Assembler struct {
 	program AnalyzedProgram
 	cpool        ConstantPool
+
+	// file and source are those the program was compiled from, for the debug section. The section is left out of
+	// the binary if the source is not known, or if stripDebug is set.
+	file       string
+	source     string
+	stripDebug bool
 }
 
 type Instruction struct {
@@ -22,6 +28,9 @@ type Instruction struct {
 
 	// labelFunc is a function that will be called once the address of this instruction is defined. Used in labels.
 	labelFunc func(address int)
+
+	// span is the source the instruction was emitted for.
+	span Span
 }
 
 func (a *Assembler) AssembleProgram() {
@@ -46,9 +55,84 @@ func (a *Assembler) AssembleProgram() {
 			}
 		}
 	}
+
+	// Jump targets are known now, so the stack usage can be followed along every path
+	for _, method := range a.program.methods {
+		a.computeMaxStack(method)
+	}
+}
+
+// computeMaxStack follows every path through the method to find the highest the operand stack gets, counting from
+// below the arguments of the method, which are on the stack when it is called. Values pushed by a called method count
+// towards the maximum of that method.
+func (a *Assembler) computeMaxStack(m *Method) {
+	var code []*Instruction
+	positions := map[int]int{}
+	for _, ins := range m.instructions {
+		if ins.Opcode != op_label {
+			positions[ins.address] = len(code)
+			code = append(code, ins)
+		}
+	}
+
+	if len(code) == 0 {
+		return
+	}
+
+	m.maxStack = len(m.arguments)
+	depths := map[int]int{0: len(m.arguments)}
+	work := []int{0}
+	for len(work) > 0 {
+		position := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		ins := code[position]
+		pops, pushes, _ := ins.stackEffect(a.program.runtime, a.callEffect)
+		depth := depths[position] + pushes - pops
+		if depth > m.maxStack {
+			m.maxStack = depth
+		}
+
+		var successors []int
+		switch ins.Opcode {
+		case op_return:
+		case op_jmp:
+			successors = []int{positions[ins.cpoolIndex]}
+		case op_jz:
+			successors = []int{position + 1, positions[ins.cpoolIndex]}
+		default:
+			successors = []int{position + 1}
+		}
+
+		for _, next := range successors {
+			if _, seen := depths[next]; !seen && next < len(code) {
+				depths[next] = depth
+				work = append(work, next)
+			}
+		}
+	}
+}
+
+// callEffect returns the stack effect of a CALL instruction to the given entry address: the arguments of the called
+// method are popped, and its return value is pushed, if it has one.
+func (a *Assembler) callEffect(operand int) (int, int, bool) {
+	for _, m := range a.program.methods {
+		if m.entry.address == operand {
+			return len(m.arguments), returnedValues(m.returnType), true
+		}
+	}
+
+	return 0, 0, false
 }
 
 func (a *Assembler) assembleNode(node ASTNode, method *Method) {
+	// Instructions are attributed to the innermost node they are emitted for
+	if method != nil {
+		outer := method.span
+		method.span = node.Position()
+		defer func() { method.span = outer }()
+	}
+
 	switch n := node.(type) {
 	case *ASTTrigger:
 		a.assembleTrigger(n)
@@ -62,20 +146,57 @@ func (a *Assembler) assembleNode(node ASTNode, method *Method) {
 		a.assembleVarAssign(n, method)
 	case *ASTMethodExpr:
 		a.assembleMethodExpr(n, method)
+	case *ASTExprStatement:
+		a.assembleExprStatement(n, method)
 	case *ASTLiteralExpr:
 		a.assembleLiteralExpr(n, method)
 	case *ASTIfStmt:
 		a.assembleIfStmt(n, method)
+	case *ASTWhileStmt:
+		a.assembleWhileStmt(n, method)
+	case *ASTForStmt:
+		a.assembleForStmt(n, method)
+	case *ASTBreakStmt:
+		method.emitJump(op_jmp, method.loops[len(method.loops)-1].breakLabel)
+	case *ASTContinueStmt:
+		method.emitJump(op_jmp, method.loops[len(method.loops)-1].continueLabel)
+	case *ASTReturnStmt:
+		a.assembleReturnStmt(n, method)
 	case *ASTLogicalExpr:
 		a.assembleLogicalExpr(n, method)
 	case *ASTIdentifierExpr:
 		a.assembleIdentifierExpr(n, method)
+	case *ASTUnaryExpr:
+		a.assembleUnaryExpr(n, method)
+	case *ASTCastExpr:
+		a.assembleNode(n.operand, method)
+
+		// Casting a number to its own type needs no conversion
+		if op, ok := conversionOp(method.TypeOfNode(n.operand), n.typ); ok {
+			method.emitOp(op)
+		}
+	case *ASTFieldExpr:
+		a.assembleNode(n.receiver, method)
+		method.emit(instr(op_getfield, n.field.InternalId))
+	case *ASTInvokeExpr:
+		a.assembleInvokeExpr(n, method)
+	case *ASTFieldAssign:
+		// The receiver goes on top of the value
+		a.assembleNode(n.value, method)
+		a.assembleNode(n.target.receiver, method)
+		method.emit(instr(op_setfield, n.target.field.InternalId))
+	case *ASTConstDecl:
+		// Constants have no code, their uses are compiled as literals
+	case *ASTGlobalDecl:
+		// Globals are set up from the globals table, not by code
 	default:
 		panic(fmt.Sprintf("No function to walk node: %T", node))
 	}
 }
 
 func (a *Assembler) assembleTrigger(n *ASTTrigger) {
+	n.method.span = n.Span
+
 	// Assemble the code belonging to this call
 	a.assembleNode(n.statement, n.method)
 
@@ -84,7 +205,8 @@ func (a *Assembler) assembleTrigger(n *ASTTrigger) {
 }
 
 func (a *Assembler) assembleFunc(n *ASTFunc) {
-	m := a.program.resolveMethod(n.name)
+	m := n.method
+	m.span = n.Span
 
 	// Assemble the parameters (take values from stack and assign to locals)
 	for _, v := range m.arguments {
@@ -107,17 +229,11 @@ func (a *Assembler) assembleIfStmt(n *ASTIfStmt, m *Method) {
 	lblEnd := m.newLabel()
 
 	// JZ to lblFalse - absolute
-	jzToLblfalse := m.emit(instr(op_jz, 0)) // Jump if false (0) to the false block
-	lblFalse.labelFunc = func(address int) {
-		jzToLblfalse.cpoolIndex = address
-	}
+	m.emitJump(op_jz, lblFalse) // Jump if false (0) to the false block
 
 	// Encode true block (jz jumps over this if expression is false)
 	a.assembleNode(n.ifTrue, m)
-	jmpToLblend := m.emit(instr(op_jmp, 0))
-	lblEnd.labelFunc = func(address int) {
-		jmpToLblend.cpoolIndex = address
-	}
+	m.emitJump(op_jmp, lblEnd)
 
 	// Encode false block (the true block jumps over this)
 	m.emit(lblFalse)
@@ -130,33 +246,84 @@ func (a *Assembler) assembleIfStmt(n *ASTIfStmt, m *Method) {
 	m.emit(lblEnd)
 }
 
-func (a *Assembler) assembleVarDecl(n *ASTVarDeclaration, m *Method) {
-	// If the local var has any expression defined, assemble it
-	if n.varValue != nil {
-		a.assembleNode(n.varValue, m)
-		m.emit(instr(op_setlocal, n.variable.index))
+func (a *Assembler) assembleWhileStmt(n *ASTWhileStmt, m *Method) {
+	lblStart := m.newLabel()
+	lblEnd := m.newLabel()
+
+	// Evaluate the condition on every iteration, leaving the loop once it is false. A loop that runs while true only
+	// ends through a break, so the code following it is unreachable without one.
+	m.emit(lblStart)
+	if !isTrueLiteral(n.condition) {
+		a.assembleNode(n.condition, m)
+		m.emitJump(op_jz, lblEnd)
 	}
+
+	a.assembleLoopBody(n.body, m, lblStart, lblEnd)
+	m.emitJump(op_jmp, lblStart)
+
+	m.emit(lblEnd)
 }
 
-func (a *Assembler) assembleVarAssign(n *ASTVarAssign, m *Method) {
-	local := m.resolveVariable(n.varName)
+func (a *Assembler) assembleForStmt(n *ASTForStmt, m *Method) {
+	lblCondition := m.newLabel()
+	lblPost := m.newLabel()
+	lblEnd := m.newLabel()
 
-	if local == nil {
-		panic("undeclared variable " + n.varName)
+	if n.init != nil {
+		a.assembleNode(n.init, m)
 	}
 
-	// Assemble the node first so it resolves the type
-	a.assembleNode(n.varValue, m)
+	// Without a condition, the loop only ends through a break
+	m.emit(lblCondition)
+	if n.condition != nil && !isTrueLiteral(n.condition) {
+		a.assembleNode(n.condition, m)
+		m.emitJump(op_jz, lblEnd)
+	}
+
+	// continue jumps to the post statement, so it is not skipped
+	a.assembleLoopBody(n.body, m, lblPost, lblEnd)
+
+	m.emit(lblPost)
+	if n.post != nil {
+		a.assembleNode(n.post, m)
+	}
+	m.emitJump(op_jmp, lblCondition)
+
+	m.emit(lblEnd)
+}
 
-	// Now verify that type against the variable type
-	exprType := m.TypeOfNode(n.varValue)
+// assembleLoopBody assembles the body of a loop, with break and continue statements jumping to the given labels.
+func (a *Assembler) assembleLoopBody(body ASTNode, m *Method, continueLabel *Instruction, breakLabel *Instruction) {
+	m.loops = append(m.loops, loopLabels{continueLabel: continueLabel, breakLabel: breakLabel})
+	a.assembleNode(body, m)
+	m.loops = m.loops[:len(m.loops)-1]
+}
+
+func (a *Assembler) assembleReturnStmt(n *ASTReturnStmt, m *Method) {
+	// The return value is left on the operand stack for the caller
+	if n.value != nil {
+		a.assembleNode(n.value, m)
+	}
 
-	// Verify types
-	if exprType != local.typ {
-		panic("assigning wrong type to '" + local.typ.String() + " " + n.varName + "' (passed: " + exprType.String() + ")")
+	m.emitOp(op_return)
+}
+
+func (a *Assembler) assembleVarDecl(n *ASTVarDeclaration, m *Method) {
+	// Variables declared without a value have been given the zero value of their type by the analyzer
+	if n.varValue != nil {
+		a.assembleNode(n.varValue, m)
+		m.emit(instr(op_setlocal, n.variable.index))
 	}
+}
 
-	m.emit(instr(op_setlocal, local.index))
+func (a *Assembler) assembleVarAssign(n *ASTVarAssign, m *Method) {
+	// The variable and the type of the value have been checked by the analyzer
+	a.assembleNode(n.varValue, m)
+	if n.global != nil {
+		m.emit(instr(op_setglobal, n.global.index))
+	} else {
+		m.emit(instr(op_setlocal, n.variable.index))
+	}
 }
 
 func (a *Assembler) assembleMethodExpr(n *ASTMethodExpr, m *Method) {
@@ -167,18 +334,69 @@ func (a *Assembler) assembleMethodExpr(n *ASTMethodExpr, m *Method) {
 
 	if n.native != nil {
 		m.emit(instr(op_nativecall, n.native.InternalId))
+
+		// Give the host a chance to park the script once the suspending call returns
+		if n.suspends {
+			m.emitOp(op_yield)
+		}
 	} else {
-		m.emit(instr(op_call, n.local.index))
+		// The entry address of the function is filled in once it is known, like the target of a jump
+		m.emitJump(op_call, n.local.entry)
+	}
+}
+
+func (a *Assembler) assembleExprStatement(n *ASTExprStatement, m *Method) {
+	a.assembleNode(n.expression, m)
+
+	// The result is not used, so it must not be left behind on the stack
+	for i := 0; i < returnedValues(m.TypeOfNode(n.expression)); i++ {
+		m.emitOp(op_pop)
+	}
+}
+
+func (a *Assembler) assembleInvokeExpr(n *ASTInvokeExpr, m *Method) {
+	// Arguments are pushed like those of a native call, with the receiver on top of them
+	for i := range n.parameters {
+		a.assembleNode(n.parameters[len(n.parameters)-i-1], m)
+	}
+
+	a.assembleNode(n.receiver, m)
+	m.emit(instr(op_invoke, n.method.InternalId))
+
+	if n.method.Suspending {
+		m.emitOp(op_yield)
 	}
 }
 
 func (a *Assembler) assembleLogicalExpr(n *ASTLogicalExpr, m *Method) {
+	if isLogicalOperator(n.comparator) {
+		a.assembleShortCircuit(n, m)
+		return
+	}
+
+	if n.comparator == tokenPlus && m.TypeOfNode(n) == VarTypeString {
+		a.assembleText(n.left, m)
+		a.assembleText(n.right, m)
+		m.emitOp(op_concat)
+		return
+	}
+
 	a.assembleNode(n.left, m)
 	a.assembleNode(n.right, m)
 
 	switch n.comparator {
 	case tokenEqual:
 		m.emitOp(op_eq)
+	case tokenNotEqual:
+		m.emitOp(op_neq)
+	case tokenLessThan:
+		m.emitOp(op_lt)
+	case tokenLessOrEqual:
+		m.emitOp(op_le)
+	case tokenGreaterThan:
+		m.emitOp(op_gt)
+	case tokenGreaterOrEqual:
+		m.emitOp(op_ge)
 	case tokenPlus:
 		m.emitOp(op_add)
 	case tokenMinus:
@@ -194,8 +412,64 @@ func (a *Assembler) assembleLogicalExpr(n *ASTLogicalExpr, m *Method) {
 	}
 }
 
+// assembleText assembles an operand of a string concatenation, converting it to text if it is not a string already.
+func (a *Assembler) assembleText(n ASTNode, m *Method) {
+	a.assembleNode(n, m)
+
+	if operand, ok := tostringOperand(m.TypeOfNode(n)); ok {
+		m.emit(instr(op_tostring, operand))
+	}
+}
+
+// assembleShortCircuit assembles && and ||, which only evaluate the right side if the left side does not already
+// decide the result.
+func (a *Assembler) assembleShortCircuit(n *ASTLogicalExpr, m *Method) {
+	lblLeftFalse := m.newLabel()
+	lblEnd := m.newLabel()
+
+	a.assembleNode(n.left, m)
+
+	if n.comparator == tokenAnd {
+		// left is true: the result is the right side. Otherwise it is false.
+		m.emitJump(op_jz, lblLeftFalse)
+		a.assembleNode(n.right, m)
+		m.emitJump(op_jmp, lblEnd)
+		m.emit(lblLeftFalse)
+		m.emit(instr(op_pushconst, a.cpool.getInt(0)))
+	} else {
+		// left is true: the result is true. Otherwise it is the right side.
+		m.emitJump(op_jz, lblLeftFalse)
+		m.emit(instr(op_pushconst, a.cpool.getInt(1)))
+		m.emitJump(op_jmp, lblEnd)
+		m.emit(lblLeftFalse)
+		a.assembleNode(n.right, m)
+	}
+
+	m.emit(lblEnd)
+}
+
+func (a *Assembler) assembleUnaryExpr(n *ASTUnaryExpr, m *Method) {
+	a.assembleNode(n.operand, m)
+
+	if n.operator == tokenNot {
+		m.emitOp(op_not)
+	} else {
+		m.emitOp(op_neg)
+	}
+}
+
 func (a *Assembler) assembleIdentifierExpr(n *ASTIdentifierExpr, m *Method) {
-	m.emit(instr(op_getlocal, n.resolved.index))
+	// Constants are folded into the constant pool, the same as the literal they stand for
+	if n.constant != nil {
+		a.assembleLiteralExpr(n.constant, m)
+		return
+	}
+
+	if n.global != nil {
+		m.emit(instr(op_getglobal, n.global.index))
+	} else {
+		m.emit(instr(op_getlocal, n.resolved.index))
+	}
 }
 
 func (a *Assembler) assembleLiteralExpr(n *ASTLiteralExpr, m *Method) {
@@ -205,8 +479,10 @@ func (a *Assembler) assembleLiteralExpr(n *ASTLiteralExpr, m *Method) {
 		m.emit(instr(op_pushconst, a.cpool.getInt(int(n.value.(int)))))
 	} else if n.literalType == LiteralLong {
 		m.emit(instr(op_pushconst, a.cpool.getLong(n.value.(int64))))
+	} else if n.literalType == LiteralFloat {
+		m.emit(instr(op_pushconst, a.cpool.getFloat(n.value.(float64))))
 	} else if n.literalType == LiteralBoolean {
-		if n.value == "true" {
+		if n.value.(bool) {
 			m.emit(instr(op_pushconst, a.cpool.getInt(int(1))))
 		} else {
 			m.emit(instr(op_pushconst, a.cpool.getInt(int(0))))
@@ -217,13 +493,29 @@ func (a *Assembler) assembleLiteralExpr(n *ASTLiteralExpr, m *Method) {
 }
 
 func (m *Method) emit(instruction *Instruction) *Instruction {
+	instruction.span = m.span
 	m.instructions = append(m.instructions, instruction)
 	return instruction
 }
 
 func (m *Method) emitOp(op Opcode) {
-	instruction := instr(op, 0)
-	m.instructions = append(m.instructions, instruction)
+	m.emit(instr(op, 0))
+}
+
+// emitJump emits a jump to the given label. The jump address is filled in once the address of the label is known, so
+// any number of jumps may target the same label, before or after it.
+func (m *Method) emitJump(op Opcode, label *Instruction) *Instruction {
+	jump := m.emit(instr(op, 0))
+
+	previous := label.labelFunc
+	label.labelFunc = func(address int) {
+		if previous != nil {
+			previous(address)
+		}
+		jump.cpoolIndex = address
+	}
+
+	return jump
 }
 
 func instr(op Opcode, i int) *Instruction {
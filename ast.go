@@ -18,10 +18,25 @@ const (
 	TypeLogicalExpr
 	TypeIdentifierExpr  // Can be either a var or a method ref
 	TypeVarAssign
+	TypeWhileStmt
+	TypeForStmt
+	TypeBreakStmt
+	TypeContinueStmt
+	TypeReturnStmt
+	TypeUnaryExpr
+	TypeFieldExpr
+	TypeInvokeExpr
+	TypeFieldAssign
+	TypeConstDecl
+	TypeGlobalDecl
+	TypeCastExpr
 )
 
 type ASTNode interface {
 	Type() ASTType
+
+	// Position returns the span of source text the node was parsed from.
+	Position() Span
 }
 
 func (t ASTType) Type() ASTType {
@@ -30,22 +45,33 @@ func (t ASTType) Type() ASTType {
 
 type ASTTrigger struct {
 	ASTType
-	trigger   string
-	value     string
+	Span
+	trigger string
+
+	// filters holds the literal filter values by listener parameter. A parameter may have several alternative values.
+	filters [][]ASTNode
+
+	// bound are the listener parameters following the filtered ones that are bound to locals, and arguments the bound
+	// arguments the listener delivers.
+	bound     []FuncArgument
+	arguments []FuncArgument
 	statement ASTNode
 
-	entry  *Trigger
-	method *Method
+	entries []*Trigger
+	method  *Method
 }
 
 func (t ASTTrigger) String() string {
-	return fmt.Sprintf("ASTTrigger{on=%s, id=%s, statement=...}", t.trigger, t.value)
+	return fmt.Sprintf("ASTTrigger{on=%s, filters=%d, statement=...}", t.trigger, len(t.filters))
 }
 
-func newTrigger(trigger string, value string, statement ASTNode) *ASTTrigger {
+func newTrigger(span Span, trigger string, filters [][]ASTNode, bound []FuncArgument, arguments []FuncArgument, statement ASTNode) *ASTTrigger {
 	return &ASTTrigger{
+		Span:      span,
 		trigger:   trigger,
-		value:     value,
+		filters:   filters,
+		bound:     bound,
+		arguments: arguments,
 		ASTType:   TypeTrigger,
 		statement: statement,
 	}
@@ -53,19 +79,24 @@ func newTrigger(trigger string, value string, statement ASTNode) *ASTTrigger {
 
 type ASTMethodExpr struct {
 	ASTType
+	Span
 	name       string
 	parameters []ASTNode
 
 	local  *Method
 	native *RuntimeFunction
+
+	// suspends is set when the called function can park the script, after which a yield is emitted.
+	suspends bool
 }
 
 func (m ASTMethodExpr) String() string {
 	return fmt.Sprintf("ASTMethodExpr{name=%s, params=%s}", m.name, m.parameters)
 }
 
-func newMethodExpr(name string, parameters ...ASTNode) *ASTMethodExpr {
+func newMethodExpr(span Span, name string, parameters ...ASTNode) *ASTMethodExpr {
 	return &ASTMethodExpr{
+		Span:       span,
 		ASTType:    TypeMethodCall,
 		name:       name,
 		parameters: parameters,
@@ -74,36 +105,45 @@ func newMethodExpr(name string, parameters ...ASTNode) *ASTMethodExpr {
 
 type ASTFunc struct {
 	ASTType
-	name      string
-	arguments []FuncArgument
-	body      ASTNode
+	Span
+	name       string
+	returnType string
+	arguments  []FuncArgument
+	body       ASTNode
+
+	method *Method
 }
 
 type FuncArgument struct {
 	name    string
 	argtype string
+	span    Span
 }
 
 func (p ASTFunc) String() string {
-	return fmt.Sprintf("ASTFunc{name=%s, args=%+v}", p.name, p.arguments)
+	return fmt.Sprintf("ASTFunc{name=%s, returns=%s, args=%+v}", p.name, p.returnType, p.arguments)
 }
 
-func newFunc(name string, body ASTNode, arguments ...FuncArgument) *ASTFunc {
+func newFunc(span Span, name string, returnType string, body ASTNode, arguments ...FuncArgument) *ASTFunc {
 	return &ASTFunc{
-		ASTType:   TypeFunc,
-		name:      name,
-		body:      body,
-		arguments: arguments,
+		Span:       span,
+		ASTType:    TypeFunc,
+		name:       name,
+		returnType: returnType,
+		body:       body,
+		arguments:  arguments,
 	}
 }
 
 type ASTExprStatement struct {
 	ASTType
+	Span
 	expression ASTNode
 }
 
-func newStmt(expr ASTNode) *ASTExprStatement {
+func newStmt(span Span, expr ASTNode) *ASTExprStatement {
 	return &ASTExprStatement{
+		Span:       span,
 		ASTType:    TypeExprStmt,
 		expression: expr,
 	}
@@ -116,6 +156,7 @@ const (
 	LiteralLong    LiteralType = iota
 	LiteralString
 	LiteralBoolean
+	LiteralFloat
 
 	LiteralUnknown = -1
 )
@@ -129,6 +170,8 @@ func LiteralToVarType(t LiteralType) VariableType {
 		return VarTypeString
 	} else if t == LiteralBoolean {
 		return VarTypeBool
+	} else if t == LiteralFloat {
+		return VarTypeFloat
 	}
 
 	return VarTypeUnresolved
@@ -136,12 +179,14 @@ func LiteralToVarType(t LiteralType) VariableType {
 
 type ASTLiteralExpr struct {
 	ASTType
+	Span
 	literalType LiteralType
 	value       interface{}
 }
 
-func newLiteral(t LiteralType, value interface{}) *ASTLiteralExpr {
+func newLiteral(span Span, t LiteralType, value interface{}) *ASTLiteralExpr {
 	return &ASTLiteralExpr{
+		Span:        span,
 		ASTType:     TypeLiteral,
 		literalType: t,
 		value:       value,
@@ -150,11 +195,13 @@ func newLiteral(t LiteralType, value interface{}) *ASTLiteralExpr {
 
 type ASTBlockStatement struct {
 	ASTType
+	Span
 	statements []ASTNode
 }
 
-func newBlock(statements ...ASTNode) *ASTBlockStatement {
+func newBlock(span Span, statements ...ASTNode) *ASTBlockStatement {
 	return &ASTBlockStatement{
+		Span:       span,
 		ASTType:    TypeBlockStmt,
 		statements: statements,
 	}
@@ -162,6 +209,7 @@ func newBlock(statements ...ASTNode) *ASTBlockStatement {
 
 type ASTVarDeclaration struct {
 	ASTType
+	Span
 	varType  string
 	varName  string
 	varValue ASTNode // Optional. If non-nil, becomes an assign instruction too.
@@ -169,8 +217,9 @@ type ASTVarDeclaration struct {
 	variable *LocalVariable
 }
 
-func newAssignment(varType, varName string, varValue ASTNode) *ASTVarDeclaration {
+func newAssignment(span Span, varType, varName string, varValue ASTNode) *ASTVarDeclaration {
 	return &ASTVarDeclaration{
+		Span:     span,
 		ASTType:  TypeVarDecl,
 		varType:  varType,
 		varName:  varName,
@@ -180,13 +229,15 @@ func newAssignment(varType, varName string, varValue ASTNode) *ASTVarDeclaration
 
 type ASTIfStmt struct {
 	ASTType
+	Span
 	condition ASTNode
 	ifTrue    ASTNode
 	ifFalse   ASTNode
 }
 
-func newIfStmt(condition ASTNode, ifTrue ASTNode, ifFalse ASTNode) *ASTIfStmt {
+func newIfStmt(span Span, condition ASTNode, ifTrue ASTNode, ifFalse ASTNode) *ASTIfStmt {
 	return &ASTIfStmt{
+		Span:      span,
 		ASTType:   TypeIfStmt,
 		condition: condition,
 		ifTrue:    ifTrue,
@@ -194,14 +245,93 @@ func newIfStmt(condition ASTNode, ifTrue ASTNode, ifFalse ASTNode) *ASTIfStmt {
 	}
 }
 
+type ASTWhileStmt struct {
+	ASTType
+	Span
+	condition ASTNode
+	body      ASTNode
+}
+
+func newWhileStmt(span Span, condition ASTNode, body ASTNode) *ASTWhileStmt {
+	return &ASTWhileStmt{
+		Span:      span,
+		ASTType:   TypeWhileStmt,
+		condition: condition,
+		body:      body,
+	}
+}
+
+type ASTForStmt struct {
+	ASTType
+	Span
+	init      ASTNode // Optional
+	condition ASTNode // Optional. Loops forever if nil.
+	post      ASTNode // Optional
+	body      ASTNode
+}
+
+func newForStmt(span Span, init ASTNode, condition ASTNode, post ASTNode, body ASTNode) *ASTForStmt {
+	return &ASTForStmt{
+		Span:      span,
+		ASTType:   TypeForStmt,
+		init:      init,
+		condition: condition,
+		post:      post,
+		body:      body,
+	}
+}
+
+type ASTBreakStmt struct {
+	ASTType
+	Span
+}
+
+func newBreakStmt(span Span) *ASTBreakStmt {
+	return &ASTBreakStmt{
+		Span:    span,
+		ASTType: TypeBreakStmt,
+	}
+}
+
+type ASTContinueStmt struct {
+	ASTType
+	Span
+}
+
+func newContinueStmt(span Span) *ASTContinueStmt {
+	return &ASTContinueStmt{
+		Span:    span,
+		ASTType: TypeContinueStmt,
+	}
+}
+
+type ASTReturnStmt struct {
+	ASTType
+	Span
+	value ASTNode // Optional, nil when returning from a void function
+}
+
+func newReturnStmt(span Span, value ASTNode) *ASTReturnStmt {
+	return &ASTReturnStmt{
+		Span:    span,
+		ASTType: TypeReturnStmt,
+		value:   value,
+	}
+}
+
 type ASTVarAssign struct {
 	ASTType
+	Span
 	varName  string
 	varValue ASTNode
+
+	variable *LocalVariable
+	global   *GlobalVariable
 }
 
-func newVarAssign(varName string, varValue ASTNode) *ASTVarAssign {
+func newVarAssign(span Span, varName string, varValue ASTNode) *ASTVarAssign {
 	return &ASTVarAssign{
+		Span:     span,
 		ASTType:  TypeVarAssign,
 		varName:  varName,
 		varValue: varValue,
@@ -210,13 +340,15 @@ func newVarAssign(varName string, varValue ASTNode) *ASTVarAssign {
 
 type ASTLogicalExpr struct {
 	ASTType
+	Span
 	left       ASTNode
 	comparator tokenType
 	right      ASTNode
 }
 
-func newLogicalExpr(left ASTNode, comparator tokenType, right ASTNode) *ASTLogicalExpr {
+func newLogicalExpr(span Span, left ASTNode, comparator tokenType, right ASTNode) *ASTLogicalExpr {
 	return &ASTLogicalExpr{
+		Span:       span,
 		ASTType:    TypeLogicalExpr,
 		left:       left,
 		comparator: comparator,
@@ -224,15 +356,158 @@ func newLogicalExpr(left ASTNode, comparator tokenType, right ASTNode) *ASTLogic
 	}
 }
 
+type ASTUnaryExpr struct {
+	ASTType
+	Span
+	operator tokenType
+	operand  ASTNode
+}
+
+func newUnaryExpr(span Span, operator tokenType, operand ASTNode) *ASTUnaryExpr {
+	return &ASTUnaryExpr{
+		Span:     span,
+		ASTType:  TypeUnaryExpr,
+		operator: operator,
+		operand:  operand,
+	}
+}
+
+// ASTCastExpr converts a number to another numeric type: (long) operand. Besides the casts written in a script, the
+// analyzer inserts them where an int is widened implicitly.
+type ASTCastExpr struct {
+	ASTType
+	Span
+	typeName string
+	operand  ASTNode
+
+	typ VariableType
+}
+
+func newCastExpr(span Span, typeName string, operand ASTNode) *ASTCastExpr {
+	return &ASTCastExpr{
+		Span:     span,
+		ASTType:  TypeCastExpr,
+		typeName: typeName,
+		operand:  operand,
+		typ:      VarTypeUnresolved,
+	}
+}
+
+// ASTFieldExpr reads a field of a native object: receiver.name
+type ASTFieldExpr struct {
+	ASTType
+	Span
+	receiver ASTNode
+	name     string
+
+	field *TypeField
+}
+
+func newFieldExpr(span Span, receiver ASTNode, name string) *ASTFieldExpr {
+	return &ASTFieldExpr{
+		Span:     span,
+		ASTType:  TypeFieldExpr,
+		receiver: receiver,
+		name:     name,
+	}
+}
+
+// ASTInvokeExpr calls a method of a native object: receiver.name(parameters)
+type ASTInvokeExpr struct {
+	ASTType
+	Span
+	receiver   ASTNode
+	name       string
+	parameters []ASTNode
+
+	method *TypeMethod
+}
+
+func newInvokeExpr(span Span, receiver ASTNode, name string, parameters ...ASTNode) *ASTInvokeExpr {
+	return &ASTInvokeExpr{
+		Span:       span,
+		ASTType:    TypeInvokeExpr,
+		receiver:   receiver,
+		name:       name,
+		parameters: parameters,
+	}
+}
+
+// ASTFieldAssign writes a field of a native object: receiver.name = value
+type ASTFieldAssign struct {
+	ASTType
+	Span
+	target *ASTFieldExpr
+	value  ASTNode
+}
+
+func newFieldAssign(span Span, target *ASTFieldExpr, value ASTNode) *ASTFieldAssign {
+	return &ASTFieldAssign{
+		Span:    span,
+		ASTType: TypeFieldAssign,
+		target:  target,
+		value:   value,
+	}
+}
+
+// ASTConstDecl declares a named constant at the top level of a script: const type name = value;
+type ASTConstDecl struct {
+	ASTType
+	Span
+	varType string
+	name    string
+	value   ASTNode
+}
+
+func newConstDecl(span Span, varType string, name string, value ASTNode) *ASTConstDecl {
+	return &ASTConstDecl{
+		Span:    span,
+		ASTType: TypeConstDecl,
+		varType: varType,
+		name:    name,
+		value:   value,
+	}
+}
+
+// ASTGlobalDecl declares a variable at the top level of a script, shared by all of its triggers and functions:
+// [persist] type name [= value];
+type ASTGlobalDecl struct {
+	ASTType
+	Span
+	varType string
+	name    string
+	value   ASTNode // Optional, the zero value of the type is used without it.
+	persist bool
+
+	global *GlobalVariable
+}
+
+func newGlobalDecl(span Span, varType string, name string, value ASTNode, persist bool) *ASTGlobalDecl {
+	return &ASTGlobalDecl{
+		Span:    span,
+		ASTType: TypeGlobalDecl,
+		varType: varType,
+		name:    name,
+		value:   value,
+		persist: persist,
+	}
+}
+
 type ASTIdentifierExpr struct {
 	ASTType
+	Span
 	identifier string
 
 	resolved *LocalVariable
+	global   *GlobalVariable
+
+	// constant is the value of the constant the identifier refers to, if it is not a variable.
+	constant *ASTLiteralExpr
 }
 
-func newIdentifier(identifier string) *ASTIdentifierExpr {
+func newIdentifier(span Span, identifier string) *ASTIdentifierExpr {
 	return &ASTIdentifierExpr{
+		Span:       span,
 		ASTType:    TypeIdentifierExpr,
 		identifier: identifier,
 	}
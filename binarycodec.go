@@ -9,7 +9,7 @@ import (
 	"io"
 )
 
-const AbiVersion = 4
+const AbiVersion = 9
 
 func (a *Assembler) Encode() []byte {
 	buffer := new(bytes.Buffer)
@@ -18,7 +18,6 @@ func (a *Assembler) Encode() []byte {
 	writer.WriteByte(AbiVersion)
 
 	// Encode triggers/event listeners
-	// TODO make triggers listeners on strings too. And support wildcards.
 	binary.Write(writer, binary.BigEndian, uint16(len(a.program.triggers)))
 	for _, trigger := range a.program.triggers {
 		binary.Write(writer, binary.BigEndian, int32(trigger.definition.InternalId))
@@ -29,13 +28,19 @@ func (a *Assembler) Encode() []byte {
 		for _, v := range trigger.values {
 			switch x := v.(type) {
 			case int:
-			case int32:
-			case uint32:
-				encodeAdderValue(writer, VarTypeInt, int32(x))
+				encodeAdderValue(writer, VarTypeInt, x)
 			case int64:
 				encodeAdderValue(writer, VarTypeLong, x)
+			case float64:
+				encodeAdderValue(writer, VarTypeFloat, x)
 			case string:
 				encodeAdderValue(writer, VarTypeString, x)
+			case Glob:
+				str := []byte(x)
+
+				binary.Write(writer, binary.BigEndian, int8(3))
+				binary.Write(writer, binary.BigEndian, uint16(len(str)))
+				binary.Write(writer, binary.BigEndian, str)
 			default:
 				panic(fmt.Errorf("cannot serialize type %T into a listener value", v))
 			}
@@ -48,6 +53,9 @@ func (a *Assembler) Encode() []byte {
 	for _, method := range a.program.methods {
 		binary.Write(writer, binary.BigEndian, int16(method.index))
 		binary.Write(writer, binary.BigEndian, int32(method.entry.address))
+		binary.Write(writer, binary.BigEndian, uint16(len(method.arguments)))
+		binary.Write(writer, binary.BigEndian, uint16(method.lvtIndex))
+		binary.Write(writer, binary.BigEndian, uint16(method.maxStack))
 
 		for _, inst := range method.instructions {
 			if inst.Opcode != op_label {
@@ -56,6 +64,34 @@ func (a *Assembler) Encode() []byte {
 		}
 	}
 
+	// Encode globals
+	globals := a.binaryGlobals()
+	binary.Write(writer, binary.BigEndian, uint16(len(globals)))
+	for _, global := range globals {
+		flags := uint8(0)
+		if global.Persist {
+			flags |= GlobalPersist
+		}
+
+		name := []byte(global.Name)
+		binary.Write(writer, binary.BigEndian, flags)
+		binary.Write(writer, binary.BigEndian, uint16(len(name)))
+		binary.Write(writer, binary.BigEndian, name)
+
+		switch x := global.Value.(type) {
+		case int:
+			encodeAdderValue(writer, VarTypeInt, x)
+		case int64:
+			encodeAdderValue(writer, VarTypeLong, x)
+		case float64:
+			encodeAdderValue(writer, VarTypeFloat, x)
+		case string:
+			encodeAdderValue(writer, VarTypeString, x)
+		default:
+			panic(fmt.Sprintf("cannot encode global %s of type %T", global.Name, x))
+		}
+	}
+
 	// Encode constant pool
 	binary.Write(writer, binary.BigEndian, int16(len(a.cpool.values)))
 	for _, v := range a.cpool.values {
@@ -69,16 +105,23 @@ func (a *Assembler) Encode() []byte {
 			if inst.Opcode != op_label {
 				binary.Write(writer, binary.BigEndian, int8(inst.Opcode))
 
-				if inst.Opcode == op_pushconst || inst.Opcode == op_nativecall ||
-					inst.Opcode == op_setlocal || inst.Opcode == op_getlocal {
+				switch inst.Opcode.operandSize() {
+				case 2:
 					binary.Write(writer, binary.BigEndian, int16(inst.cpoolIndex))
-				} else if inst.Opcode == op_call || inst.Opcode == op_jz || inst.Opcode == op_jmp {
+				case 4:
 					binary.Write(writer, binary.BigEndian, int32(inst.cpoolIndex))
 				}
 			}
 		}
 	}
 
+	// Encode the optional debug section, prefixed with its length so it can be skipped
+	if debug := a.debugInfo(); debug != nil {
+		section := encodeDebugInfo(debug)
+		binary.Write(writer, binary.BigEndian, uint32(len(section)))
+		writer.Write(section)
+	}
+
 	writer.Flush()
 	return buffer.Bytes()
 }
@@ -90,6 +133,9 @@ func encodeAdderValue(w io.Writer, typ VariableType, value interface{}) {
 	} else if typ == VarTypeLong {
 		binary.Write(w, binary.BigEndian, int8(1))
 		binary.Write(w, binary.BigEndian, value.(int64))
+	} else if typ == VarTypeFloat {
+		binary.Write(w, binary.BigEndian, int8(4))
+		binary.Write(w, binary.BigEndian, value.(float64))
 	} else if typ == VarTypeString {
 		str := []byte(value.(string))
 
@@ -101,7 +147,316 @@ func encodeAdderValue(w io.Writer, typ VariableType, value interface{}) {
 	}
 }
 
+// binaryGlobals returns the globals table of the program, as it is written to the binary.
+func (a *Assembler) binaryGlobals() []*BinaryGlobal {
+	var globals []*BinaryGlobal
+	for _, v := range a.program.globals {
+		value := v.value.value
+		if b, ok := value.(bool); ok {
+			value = 0
+			if b {
+				value = 1
+			}
+		}
+
+		globals = append(globals, &BinaryGlobal{Name: v.name, Persist: v.persist, Value: value})
+	}
+
+	return globals
+}
+
 func (a *Assembler) EncodeToFile(file string) error {
 	data := a.Encode()
 	return ioutil.WriteFile(file, data, 0664)
 }
+
+// Binary is the in-memory form of a compiled adder binary, as read back by Decode.
+type Binary struct {
+	Version   int
+	Triggers  []*BinaryTrigger
+	Methods   []*BinaryMethod
+	Globals   []*BinaryGlobal
+	Constants []*ConstantPoolEntry
+
+	// Code is the flat instruction stream. Addresses are indices into this slice.
+	Code []*Instruction
+
+	// Debug maps the code back to its source, or is nil if the binary has no debug section.
+	Debug *DebugInfo
+}
+
+// BinaryTrigger is an entry of the trigger table. Values holds the filter values by listener parameter: an int, int64,
+// string or Glob. An event matches the trigger if it matches all of them.
+type BinaryTrigger struct {
+	ListenerId int
+	Address    int
+	Values     []interface{}
+}
+
+// Glob is a trigger filter value matching strings, in which * matches any run of characters and ? matches any single
+// character.
+type Glob string
+
+// BinaryGlobal is an entry of the globals table. Value is the initial value of the global: an int, int64, float64 or
+// string.
+// Globals declared as bool are stored as the int 0 or 1, the same as they are on the stack.
+type BinaryGlobal struct {
+	Name    string
+	Persist bool
+	Value   interface{}
+}
+
+// Flags of a globals table entry.
+const (
+	// GlobalPersist marks a global that the host saves and restores across restarts.
+	GlobalPersist uint8 = 1 << iota
+)
+
+// BinaryMethod is an entry of the method table. Arguments is the number of values the method takes off the stack of its
+// caller, Locals the number of local variable slots of its frame (arguments included) and MaxStack the number of
+// operand stack slots it needs, arguments included and not counting the methods it calls.
+type BinaryMethod struct {
+	Index     int
+	Entry     int
+	Arguments int
+	Locals    int
+	MaxStack  int
+}
+
+// binaryReader reads big endian values, remembering the first error so decoding code doesn't need to check every read.
+type binaryReader struct {
+	r    *bytes.Reader
+	size int
+	err  error
+
+	// section describes what is being read, for error messages.
+	section string
+}
+
+func (b *binaryReader) read(v interface{}) {
+	if b.err != nil {
+		return
+	}
+
+	offset := b.offset()
+	if err := binary.Read(b.r, binary.BigEndian, v); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			b.err = fmt.Errorf("truncated binary: unexpected end of data at offset %d while reading %s", offset, b.section)
+		} else {
+			b.err = fmt.Errorf("error at offset %d while reading %s: %s", offset, b.section, err)
+		}
+	}
+}
+
+// fail records a malformed value that was read successfully, but cannot be valid.
+func (b *binaryReader) fail(format string, args ...interface{}) {
+	if b.err == nil {
+		b.err = fmt.Errorf("malformed binary at offset %d while reading %s: %s", b.offset(), b.section, fmt.Sprintf(format, args...))
+	}
+}
+
+func (b *binaryReader) offset() int {
+	return b.size - b.r.Len()
+}
+
+func (b *binaryReader) int8() int {
+	var v int8
+	b.read(&v)
+	return int(v)
+}
+
+func (b *binaryReader) uint8() int {
+	var v uint8
+	b.read(&v)
+	return int(v)
+}
+
+func (b *binaryReader) int16() int {
+	var v int16
+	b.read(&v)
+	return int(v)
+}
+
+func (b *binaryReader) uint16() int {
+	var v uint16
+	b.read(&v)
+	return int(v)
+}
+
+func (b *binaryReader) int32() int {
+	var v int32
+	b.read(&v)
+	return int(v)
+}
+
+// Decode reads a binary in the format written by Encode, including the debug section if there is one. Binaries of another
+// bytecode version, truncated binaries and binaries containing unknown opcodes, unknown value types or trailing data are
+// rejected with an error.
+func Decode(data []byte) (*Binary, error) {
+	r := &binaryReader{r: bytes.NewReader(data), size: len(data)}
+	bin := &Binary{}
+
+	r.section = "bytecode version"
+	bin.Version = r.uint8()
+	if r.err == nil && bin.Version != AbiVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d, expected %d", bin.Version, AbiVersion)
+	}
+
+	// Triggers/event listeners
+	r.section = "trigger table"
+	numTriggers := r.uint16()
+	for i := 0; i < numTriggers && r.err == nil; i++ {
+		trigger := &BinaryTrigger{
+			ListenerId: r.int32(),
+			Address:    r.int32(),
+		}
+
+		numValues := r.int8()
+		if numValues < 0 {
+			r.fail("negative value count %d for trigger %d", numValues, i)
+		}
+
+		for j := 0; j < numValues && r.err == nil; j++ {
+			trigger.Values = append(trigger.Values, decodeTriggerValue(r))
+		}
+
+		bin.Triggers = append(bin.Triggers, trigger)
+	}
+
+	// Methods
+	r.section = "method table"
+	numMethods := r.uint16()
+	for i := 0; i < numMethods && r.err == nil; i++ {
+		bin.Methods = append(bin.Methods, &BinaryMethod{
+			Index:     r.int16(),
+			Entry:     r.int32(),
+			Arguments: r.uint16(),
+			Locals:    r.uint16(),
+			MaxStack:  r.uint16(),
+		})
+	}
+
+	// Globals
+	r.section = "globals table"
+	numGlobals := r.uint16()
+	for i := 0; i < numGlobals && r.err == nil; i++ {
+		flags := uint8(r.uint8())
+		name := make([]byte, r.uint16())
+		r.read(name)
+		_, value := decodeAdderValue(r)
+
+		bin.Globals = append(bin.Globals, &BinaryGlobal{Name: string(name), Persist: flags&GlobalPersist != 0, Value: value})
+	}
+
+	// Constant pool
+	r.section = "constant pool"
+	numConstants := r.int16()
+	if numConstants < 0 {
+		r.fail("negative constant count %d", numConstants)
+	}
+
+	for i := 0; i < numConstants && r.err == nil; i++ {
+		typ, value := decodeAdderValue(r)
+		bin.Constants = append(bin.Constants, &ConstantPoolEntry{Type: typ, Value: value})
+	}
+
+	// Method code
+	r.section = "instructions"
+	numInstructions := r.int32()
+	if numInstructions < 0 || numInstructions > r.r.Len() {
+		// Every instruction takes at least a byte, so this catches garbage counts before allocating for them.
+		r.fail("invalid instruction count %d", numInstructions)
+	}
+
+	for i := 0; i < numInstructions && r.err == nil; i++ {
+		inst := &Instruction{Opcode: Opcode(r.uint8()), address: i}
+		if _, ok := opcodeNames[inst.Opcode]; !ok && r.err == nil {
+			r.fail("unknown opcode %d at address %d", inst.Opcode, i)
+		}
+
+		switch inst.Opcode.operandSize() {
+		case 2:
+			inst.cpoolIndex = r.int16()
+		case 4:
+			inst.cpoolIndex = r.int32()
+		}
+
+		bin.Code = append(bin.Code, inst)
+	}
+
+	// Debug info
+	if r.err == nil && r.r.Len() > 0 {
+		r.section = "debug section"
+
+		var length uint32
+		r.read(&length)
+		if r.err == nil && int64(length) > int64(r.r.Len()) {
+			r.fail("length %d exceeds the %d bytes left", length, r.r.Len())
+		}
+
+		if r.err == nil {
+			bin.Debug = decodeDebugInfo(r, int(length))
+		}
+	}
+
+	if r.err == nil && r.r.Len() > 0 {
+		r.fail("%d bytes of trailing data after the last section", r.r.Len())
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return bin, nil
+}
+
+func decodeAdderValue(r *binaryReader) (VariableType, interface{}) {
+	return decodeTaggedValue(r, r.int8())
+}
+
+// decodeTriggerValue decodes a trigger filter value, which besides the regular values can also be a glob pattern.
+func decodeTriggerValue(r *binaryReader) interface{} {
+	tag := r.int8()
+	if tag == 3 {
+		str := make([]byte, r.uint16())
+		r.read(str)
+		return Glob(str)
+	}
+
+	_, value := decodeTaggedValue(r, tag)
+	return value
+}
+
+func decodeTaggedValue(r *binaryReader, tag int) (VariableType, interface{}) {
+	switch tag {
+	case 0:
+		return VarTypeInt, r.int32()
+	case 1:
+		var v int64
+		r.read(&v)
+		return VarTypeLong, v
+	case 2:
+		str := make([]byte, r.uint16())
+		r.read(str)
+		return VarTypeString, string(str)
+	case 4:
+		var v float64
+		r.read(&v)
+		return VarTypeFloat, v
+	default:
+		if r.err == nil {
+			r.fail("unknown value type %d", tag)
+		}
+		return VarTypeUnresolved, nil
+	}
+}
+
+// DecodeFile reads and decodes a binary from disk.
+func DecodeFile(file string) (*Binary, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Decode(data)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRejectsMalformed(t *testing.T) {
+	assembler := compileScript(t, `
+func check(int value) {
+	if (value == 1) {
+		println("one");
+	}
+}
+
+on number_typed(1) {
+	check(1);
+}
+`)
+	data := assembler.Encode()
+	assembler.StripDebugInfo()
+	stripped := assembler.Encode()
+
+	if _, err := Decode(data); err != nil {
+		t.Fatal(err)
+	}
+
+	// A binary cut short has to be rejected, not read past its end, unless it is cut right before the optional debug
+	// section
+	for i := 0; i < len(data); i++ {
+		if _, err := Decode(data[:i]); err == nil && i != len(stripped) {
+			t.Fatalf("decoded a binary truncated to %d of %d bytes", i, len(data))
+		}
+	}
+
+	if _, err := Decode(append(data, 0)); err == nil || !strings.Contains(err.Error(), "trailing") {
+		t.Fatalf("expected trailing data to be rejected, got %v", err)
+	}
+
+	other := append([]byte{}, data...)
+	other[0]++
+	if _, err := Decode(other); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Fatalf("expected another bytecode version to be rejected, got %v", err)
+	}
+}
+
+func TestMethodTable(t *testing.T) {
+	script := loadScript(t, `
+func int add(int a, int b) {
+	return a + b;
+}
+
+func void nothing() {
+}
+
+on number_typed(int number) {
+	println(add(add(1, 2), number));
+}
+`)
+
+	for i, expected := range []BinaryMethod{
+		{Index: 0, Arguments: 2, Locals: 2, MaxStack: 2},
+		{Index: 1, Arguments: 0, Locals: 0, MaxStack: 0},
+		{Index: 2, Arguments: 0, Locals: 1, MaxStack: 3},
+	} {
+		method := *script.vm.binary.Methods[i]
+		method.Entry = 0
+		if method != expected {
+			t.Errorf("method %d is %+v, expected %+v", i, method, expected)
+		}
+	}
+}
+
+func TestDebugInfo(t *testing.T) {
+	assembler := compileScript(t, `
+func int divide(int a, int b) {
+	return a / b;
+}
+
+on number_typed(int number) {
+	println(divide(10, number));
+}
+`)
+
+	bin, err := Decode(assembler.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	debug := bin.Debug
+	if debug == nil || debug.File != "test.adr" || len(debug.Methods) != 2 {
+		t.Fatalf("unexpected debug info %+v", debug)
+	}
+
+	if m := debug.Methods[0]; m.Name != "divide" || strings.Join(m.Locals, ",") != "a,b" {
+		t.Errorf("unexpected debug info %+v for divide", *m)
+	}
+
+	if m := debug.Methods[1]; !strings.HasPrefix(m.Name, "@number_typed") || strings.Join(m.Locals, ",") != "number" {
+		t.Errorf("unexpected debug info %+v for the trigger", *m)
+	}
+
+	// The division is attributed to just the expression a / b
+	div := find(bin, op_div).address
+	if span := debug.Span(div); span != (DebugSpan{Address: span.Address, Line: 3, Column: 9, EndLine: 3, EndColumn: 14}) {
+		t.Errorf("DIV has span %+v", span)
+	}
+
+	if location := bin.Locate(div); location != "test.adr:3 in divide" {
+		t.Errorf("DIV is located at %q", location)
+	}
+
+	// Stripping the debug info leaves the rest of the binary as it was
+	data := assembler.Encode()
+	assembler.StripDebugInfo()
+	stripped := assembler.Encode()
+	if len(stripped) >= len(data) || !bytes.Equal(stripped, data[:len(stripped)]) {
+		t.Fatalf("stripped binary of %d bytes is not the start of the full binary of %d bytes", len(stripped), len(data))
+	}
+
+	if bin, err := Decode(stripped); err != nil || bin.Debug != nil || bin.Locate(div) != "" {
+		t.Fatalf("expected a binary without debug info, got %v", err)
+	}
+}
+
+func TestFloatRoundTrip(t *testing.T) {
+	source := `
+const float HALF = 0.5;
+persist float ratio = 2.5;
+
+on program_start() {
+	ratio = ratio * HALF;
+	println(ratio);
+}
+`
+	bin, err := Decode(compileScript(t, source).Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, v := range bin.Constants {
+		found = found || (v.Type == VarTypeFloat && v.Value == 0.5)
+	}
+
+	if !found || len(bin.Globals) != 1 || bin.Globals[0].Value != 2.5 {
+		t.Fatalf("unexpected constants %v or globals %v", bin.Constants, bin.Globals)
+	}
+
+	script := loadScript(t, source)
+	if err := script.vm.Dispatch(1); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := script.vm.PersistentGlobals()
+	if saved["ratio"] != 1.25 {
+		t.Fatalf("unexpected persistent globals %v", saved)
+	}
+
+	restarted := loadScript(t, source)
+	if err := restarted.vm.RestoreGlobals(map[string]interface{}{"ratio": 10.0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restarted.vm.Dispatch(1); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "1.25")
+	restarted.expectOutput(t, "5")
+}
@@ -0,0 +1,39 @@
+package main
+
+// Compile runs a single source file through the scanner, parser, analyzer and assembler. All problems found are
+// returned as diagnostics, located in the given file. The assembler is only returned if there were no errors.
+func Compile(runtime *AdderRuntime, file string, source string) (assembler *Assembler, diagnostics []Diagnostic) {
+	defer func() {
+		// A panic here is a bug in the compiler, but it should not take down the compilation of other files.
+		if r := recover(); r != nil {
+			assembler = nil
+			diagnostics = append(diagnostics, newError(ErrInternal, Span{}, "internal compiler error: %v", r))
+		}
+
+		for i := range diagnostics {
+			diagnostics[i].locate(file, source)
+		}
+	}()
+
+	tokens, diagnostics := ScanText(source)
+	if HasErrors(diagnostics) {
+		return nil, diagnostics
+	}
+
+	nodes, parseDiagnostics := Parse(source, tokens)
+	diagnostics = append(diagnostics, parseDiagnostics...)
+	if HasErrors(diagnostics) {
+		return nil, diagnostics
+	}
+
+	program, analyzerDiagnostics := ProcessAndAnalyzeProgram(runtime, nodes)
+	diagnostics = append(diagnostics, analyzerDiagnostics...)
+	if HasErrors(diagnostics) {
+		return nil, diagnostics
+	}
+
+	assembler = &Assembler{program: program, file: file, source: source}
+	assembler.AssembleProgram()
+
+	return assembler, diagnostics
+}
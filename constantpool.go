@@ -1,5 +1,6 @@
 package main
 
+import "math"
 
 type ConstantPool struct {
 	values []*ConstantPoolEntry
@@ -40,6 +41,22 @@ func (c *ConstantPool) getLong(i int64) int {
 	return len(c.values) - 1
 }
 
+// getFloat compares floats by their bits, so that -0.0 and NaN get their own entries.
+func (c *ConstantPool) getFloat(f float64) int {
+	for k, v := range c.values {
+		if v.Type == VarTypeFloat && math.Float64bits(v.Value.(float64)) == math.Float64bits(f) {
+			return k
+		}
+	}
+
+	c.values = append(c.values, &ConstantPoolEntry{
+		Type:  VarTypeFloat,
+		Value: f,
+	})
+
+	return len(c.values) - 1
+}
+
 func (c *ConstantPool) getString(s string) int {
 	for k, v := range c.values {
 		if v.Type == VarTypeString && v.Value.(string) == s {
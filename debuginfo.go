@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DebugInfo maps the bytecode of a binary back to the source it was compiled from. It is written to an optional
+// section at the end of the binary, which VMs that have no use for it can skip.
+type DebugInfo struct {
+	// File is the name of the source file, without its directory.
+	File string
+
+	// Methods holds the source names of the methods, in the order of the method table.
+	Methods []*DebugMethod
+
+	// Spans maps addresses to the source they were compiled from. An entry covers the instructions from its address
+	// up to the address of the next entry, so there is only one for every change of span. Entries are sorted by
+	// address.
+	Spans []*DebugSpan
+}
+
+// DebugMethod holds the source names of a method and its locals. Triggers have a generated name starting with '@'.
+type DebugMethod struct {
+	Name string
+
+	// Locals holds the name of every local slot by index. Event values that a trigger does not bind have a generated
+	// name starting with '@'.
+	Locals []string
+}
+
+// DebugSpan is an entry of the span table. The source of the instructions starts at Line and Column, and ends right
+// before EndLine and EndColumn. Lines and columns start at 1, and columns count bytes, like those of diagnostics. Line
+// 0 means the source is not known.
+type DebugSpan struct {
+	Address   int
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+}
+
+// StripDebugInfo leaves the debug section out of the binary, for hosts that have no use for it.
+func (a *Assembler) StripDebugInfo() {
+	a.stripDebug = true
+}
+
+// debugInfo collects the debug info of the program. There is none if the source it was compiled from is not known, or
+// if it has been stripped.
+func (a *Assembler) debugInfo() *DebugInfo {
+	if a.source == "" || a.stripDebug {
+		return nil
+	}
+
+	lines := lineStarts(a.source)
+	debug := &DebugInfo{File: filepath.Base(a.file)}
+
+	for _, method := range a.program.methods {
+		locals := make([]string, method.lvtIndex)
+		for _, v := range method.variables {
+			if v.index >= 0 && v.index < len(locals) {
+				locals[v.index] = v.name
+			}
+		}
+
+		debug.Methods = append(debug.Methods, &DebugMethod{Name: method.name, Locals: locals})
+
+		for _, ins := range method.instructions {
+			if ins.Opcode == op_label {
+				continue
+			}
+
+			// An instruction without a span has no known source, which is left at line 0
+			span := DebugSpan{Address: ins.address}
+			if ins.span != (Span{}) {
+				span.Line, span.Column = sourcePosition(lines, ins.span.From)
+				span.EndLine, span.EndColumn = sourcePosition(lines, ins.span.To)
+			}
+
+			if n := len(debug.Spans); n > 0 {
+				last := *debug.Spans[n-1]
+				last.Address = span.Address
+				if last == span {
+					continue
+				}
+			}
+
+			debug.Spans = append(debug.Spans, &span)
+		}
+	}
+
+	return debug
+}
+
+// lineStarts returns the offsets at which the lines of the source start. The line of an offset is the number of lines
+// starting at or before it.
+func lineStarts(source string) []int {
+	starts := []int{0}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+
+	return starts
+}
+
+// sourcePosition returns the line and column of an offset, given the offsets at which the lines start.
+func sourcePosition(lines []int, offset int) (int, int) {
+	line := sort.SearchInts(lines, offset+1)
+	return line, offset - lines[line-1] + 1
+}
+
+func encodeDebugInfo(debug *DebugInfo) []byte {
+	buffer := new(bytes.Buffer)
+	writer := bufio.NewWriter(buffer)
+
+	encodeDebugString(writer, debug.File)
+
+	binary.Write(writer, binary.BigEndian, uint16(len(debug.Methods)))
+	for _, method := range debug.Methods {
+		encodeDebugString(writer, method.Name)
+
+		binary.Write(writer, binary.BigEndian, uint16(len(method.Locals)))
+		for _, v := range method.Locals {
+			encodeDebugString(writer, v)
+		}
+	}
+
+	binary.Write(writer, binary.BigEndian, uint32(len(debug.Spans)))
+	for _, v := range debug.Spans {
+		binary.Write(writer, binary.BigEndian, int32(v.Address))
+		binary.Write(writer, binary.BigEndian, int32(v.Line))
+		binary.Write(writer, binary.BigEndian, int32(v.Column))
+		binary.Write(writer, binary.BigEndian, int32(v.EndLine))
+		binary.Write(writer, binary.BigEndian, int32(v.EndColumn))
+	}
+
+	writer.Flush()
+	return buffer.Bytes()
+}
+
+func encodeDebugString(writer *bufio.Writer, value string) {
+	str := []byte(value)
+	binary.Write(writer, binary.BigEndian, uint16(len(str)))
+	binary.Write(writer, binary.BigEndian, str)
+}
+
+// decodeDebugInfo reads the debug section, which has to take up exactly the given number of bytes.
+func decodeDebugInfo(r *binaryReader, length int) *DebugInfo {
+	end := r.offset() + length
+	debug := &DebugInfo{File: decodeDebugString(r)}
+
+	numMethods := r.uint16()
+	for i := 0; i < numMethods && r.err == nil; i++ {
+		method := &DebugMethod{Name: decodeDebugString(r)}
+
+		numLocals := r.uint16()
+		for j := 0; j < numLocals && r.err == nil; j++ {
+			method.Locals = append(method.Locals, decodeDebugString(r))
+		}
+
+		debug.Methods = append(debug.Methods, method)
+	}
+
+	var numSpans uint32
+	r.read(&numSpans)
+	if r.err == nil && int64(numSpans)*20 > int64(r.r.Len()) {
+		r.fail("invalid span count %d", numSpans)
+	}
+
+	for i := 0; i < int(numSpans) && r.err == nil; i++ {
+		debug.Spans = append(debug.Spans, &DebugSpan{
+			Address:   r.int32(),
+			Line:      r.int32(),
+			Column:    r.int32(),
+			EndLine:   r.int32(),
+			EndColumn: r.int32(),
+		})
+	}
+
+	if r.err == nil && r.offset() != end {
+		r.fail("section ends at offset %d, but its length says %d", r.offset(), end)
+	}
+
+	return debug
+}
+
+func decodeDebugString(r *binaryReader) string {
+	str := make([]byte, r.uint16())
+	r.read(str)
+	return string(str)
+}
+
+// Span returns the source span of the instruction at the given address. Its line is 0 if the source is not known.
+func (d *DebugInfo) Span(address int) DebugSpan {
+	i := sort.Search(len(d.Spans), func(i int) bool { return d.Spans[i].Address > address })
+	if i == 0 {
+		return DebugSpan{Address: address}
+	}
+
+	return *d.Spans[i-1]
+}
+
+// Locate describes where the instruction at the given address comes from, such as "doors.adr:14 in open_door". It
+// returns an empty string if the binary has no debug info.
+func (b *Binary) Locate(address int) string {
+	if b.Debug == nil {
+		return ""
+	}
+
+	location := b.Debug.File
+	if span := b.Debug.Span(address); span.Line > 0 {
+		location += fmt.Sprintf(":%d", span.Line)
+	}
+
+	// The instruction belongs to the method with the last entry before it
+	var method *BinaryMethod
+	index := 0
+	for i, v := range b.Methods {
+		if v.Entry <= address && (method == nil || v.Entry > method.Entry) {
+			method, index = v, i
+		}
+	}
+
+	if method != nil && index < len(b.Debug.Methods) {
+		location += " in " + debugMethodName(b.Debug.Methods[index].Name)
+	}
+
+	return location
+}
+
+// debugMethodName returns how a method is referred to in locations. Triggers are named after their listener.
+func debugMethodName(name string) string {
+	if strings.HasPrefix(name, "@") {
+		return "on " + strings.Split(name, "@")[1]
+	}
+
+	return name
+}
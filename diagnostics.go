@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+
+	return "error"
+}
+
+// DiagnosticCode identifies the kind of a diagnostic. Codes are stable: once released, a code is never reused for a
+// different kind of problem, so tooling can match on them.
+type DiagnosticCode string
+
+const (
+	// Scanner errors
+	ErrUnknownChar        DiagnosticCode = "E0100"
+	ErrUnterminatedString DiagnosticCode = "E0101"
+	ErrInvalidEscape      DiagnosticCode = "E0102"
+
+	// Parser errors
+	ErrUnexpectedToken DiagnosticCode = "E0200"
+	ErrInvalidLiteral  DiagnosticCode = "E0201"
+
+	// Analyzer errors
+	ErrUnknownTrigger        DiagnosticCode = "E0300"
+	ErrInvalidTriggerValue   DiagnosticCode = "E0301"
+	ErrUnresolvedType        DiagnosticCode = "E0302"
+	ErrRedeclaredVariable    DiagnosticCode = "E0303"
+	ErrUndefinedVariable     DiagnosticCode = "E0304"
+	ErrRedefinedFunction     DiagnosticCode = "E0305"
+	ErrUnresolvedMethod      DiagnosticCode = "E0306"
+	ErrTypeMismatch          DiagnosticCode = "E0307"
+	ErrUnsupportedOperator   DiagnosticCode = "E0308"
+	ErrUninitializedVariable DiagnosticCode = "E0309"
+	ErrBranchOutsideLoop     DiagnosticCode = "E0310"
+	ErrMissingReturn         DiagnosticCode = "E0311"
+	ErrUnknownMember         DiagnosticCode = "E0312"
+	ErrReadOnlyField         DiagnosticCode = "E0313"
+	ErrAssignToConstant      DiagnosticCode = "E0314"
+	ErrNarrowingConversion   DiagnosticCode = "E0315"
+
+	// Internal compiler errors; these indicate a bug in the compiler rather than in the script.
+	ErrInternal DiagnosticCode = "E0900"
+)
+
+// Span is a range of byte offsets into the source, from inclusive to exclusive. The zero Span means the location is
+// unknown.
+type Span struct {
+	From int
+	To   int
+}
+
+// Position returns the span itself, so that every node embedding a Span implements ASTNode.
+func (s Span) Position() Span {
+	return s
+}
+
+// LineColumn returns the line and column, both starting at 1, that the span starts at in the given source.
+func (s Span) LineColumn(source string) (int, int) {
+	line, column, _ := generateErrorIndicator(source, s)
+	return line, column
+}
+
+// Diagnostic is a single problem found while compiling a script.
+type Diagnostic struct {
+	File     string
+	Line     int // Line number starting at 1, or 0 if the location is unknown
+	Column   int // Column (in bytes) starting at 1
+	Severity Severity
+	Code     DiagnosticCode
+	Message  string
+
+	// Indicator is the offending source line with a ^^ marker below the span, if the location is known.
+	Indicator string
+
+	span Span
+}
+
+func newError(code DiagnosticCode, span Span, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		span:     span,
+	}
+}
+
+// Error formats the diagnostic the way compilers usually do: file:line:column: severity[code]: message
+func (d Diagnostic) Error() string {
+	location := d.File
+	if d.Line > 0 {
+		location += ":" + strconv.Itoa(d.Line) + ":" + strconv.Itoa(d.Column)
+	}
+
+	return fmt.Sprintf("%s: %s[%s]: %s", location, d.Severity, d.Code, d.Message)
+}
+
+// HasErrors returns true if any of the diagnostics is an error rather than a warning.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, v := range diagnostics {
+		if v.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// locate fills in the file, line, column and indicator of a diagnostic from its span.
+func (d *Diagnostic) locate(file string, source string) {
+	d.File = file
+	if d.span == (Span{}) {
+		return
+	}
+
+	d.Line, d.Column, d.Indicator = generateErrorIndicator(source, d.span)
+}
+
+// generateErrorIndicator finds the line and column of a span, and renders the line it is on with a ^^-indicator below
+// the span.
+func generateErrorIndicator(source string, span Span) (int, int, string) {
+	sourcelen := len(source)
+	lineStart := 0
+	lineEnd := sourcelen
+	lineNumber := 1
+
+	if span.From > sourcelen {
+		span.From = sourcelen
+	}
+
+	// Find line start..
+	for i := 0; i < span.From; i++ {
+		if source[i] == '\n' && i != sourcelen-1 {
+			lineStart = i + 1
+			lineNumber++
+		}
+	}
+
+	// Find line end..
+	for i := lineStart; i < sourcelen; i++ {
+		if source[i] == '\n' || source[i] == '\r' {
+			lineEnd = i
+			break
+		}
+	}
+
+	// Create ^^-indicator, at least one wide and not running past the end of the line
+	col := span.From - lineStart
+	width := span.To - span.From
+	if span.From+width > lineEnd {
+		width = lineEnd - span.From
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	lineNumberStr := strconv.Itoa(lineNumber) + ": "
+	line := strings.Replace(source[lineStart:lineEnd], "\t", " ", -1)
+	indicator := strings.Repeat(" ", len(lineNumberStr)+col) + strings.Repeat("^", width)
+
+	return lineNumber, col + 1, fmt.Sprintf("%s%s\n%s", lineNumberStr, line, indicator)
+}
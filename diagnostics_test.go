@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestDiagnostics(t *testing.T) {
+	for _, test := range []struct {
+		source string
+		code   DiagnosticCode
+	}{
+		{"on number_typed(1) { int x = 1 # 2; }", ErrUnknownChar},
+		{"on number_typed(1) { int x = ; }", ErrUnexpectedToken},
+		{"on unknown_listener(1) { }", ErrUnknownTrigger},
+		{"on number_typed(1) { thing x = 1; }", ErrUnresolvedType},
+		{"on number_typed(1) { int x = 1; int x = 2; }", ErrRedeclaredVariable},
+		{"on number_typed(1) { println(y); }", ErrUndefinedVariable},
+		{"func twice() { }\nfunc twice() { }", ErrRedefinedFunction},
+		{"on number_typed(1) { missing(); }", ErrUnresolvedMethod},
+		{`on number_typed(1) { int x = "text"; }`, ErrTypeMismatch},
+	} {
+		diagnostics := compileErrors(t, test.source)
+		if diagnostics[0].Code != test.code {
+			t.Errorf("expected %s for %q, got %v", test.code, test.source, diagnostics)
+		}
+	}
+
+	// A script with an error should not stop the errors in the rest of it from being reported
+	diagnostics := compileErrors(t, "on number_typed(1) { println(a); println(b); }")
+	if len(diagnostics) != 2 {
+		t.Errorf("expected both undefined variables to be reported, got %v", diagnostics)
+	}
+}
+
+func TestDiagnosticPositions(t *testing.T) {
+	diagnostics := compileErrors(t, `
+on number_typed(1) {
+	println(missing);
+	int count = 1;
+	int count = 2;
+	unknown(count);
+}
+`)
+
+	expected := []struct {
+		code   DiagnosticCode
+		line   int
+		column int
+	}{
+		{ErrUndefinedVariable, 3, 10},
+		{ErrRedeclaredVariable, 5, 2},
+		{ErrUnresolvedMethod, 6, 2},
+	}
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diagnostics)
+	}
+
+	for i, v := range expected {
+		d := diagnostics[i]
+		if d.Code != v.code || d.Line != v.line || d.Column != v.column {
+			t.Errorf("expected %s at %d:%d, got %s", v.code, v.line, v.column, d.Error())
+		}
+	}
+
+	if diagnostics[0].Indicator == "" {
+		t.Errorf("expected an indicator for %s", diagnostics[0].Error())
+	}
+}
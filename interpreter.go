@@ -0,0 +1,1080 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// NativeFunc is a host function that can be called from a script through NATIVECALL. The arguments are passed in
+// declaration order, converted to the Go types listed at toHostValue. Functions declared as void return nil.
+type NativeFunc func(instance *ScriptInstance, args []interface{}) (interface{}, error)
+
+// FieldGetter reads a field of a native object for GETFIELD. The value is converted like the result of a NativeFunc.
+type FieldGetter func(instance *ScriptInstance, receiver interface{}) (interface{}, error)
+
+// FieldSetter writes a field of a native object for SETFIELD. The value is converted like an argument of a NativeFunc.
+type FieldSetter func(instance *ScriptInstance, receiver interface{}, value interface{}) error
+
+// NativeMethod is a host function that is called on a native object through INVOKE. Arguments and the result are
+// converted like those of a NativeFunc.
+type NativeMethod func(instance *ScriptInstance, receiver interface{}, args []interface{}) (interface{}, error)
+
+// Interpreter is a reference implementation of an execution engine for adder binaries. It executes the bytecode
+// produced by the assembler directly, without any compilation step of its own.
+type Interpreter struct {
+	binary    *Binary
+	runtime   *AdderRuntime
+	constants []interface{}
+	natives   map[int]NativeFunc
+
+	// globals holds the values of the script globals, shared by all instances.
+	globals []interface{}
+
+	// frameSizes holds the number of local slots of every method by its entry address, from the method table.
+	frameSizes map[int]int
+
+	getters   map[int]FieldGetter
+	setters   map[int]FieldSetter
+	methods   map[int]NativeMethod
+}
+
+// ScriptInstance is a single execution of a script, starting at a trigger or method entry point. All state of the
+// script lives in the instance, so it can be parked at a YIELD and resumed later without holding on to a goroutine.
+type ScriptInstance struct {
+	interpreter *Interpreter
+	pc          int
+	stack       []interface{}
+	frames      []*frame
+
+	// suspended is set by YIELD and cleared when the instance is run again.
+	suspended bool
+
+	// Wake condition requested by a suspending host function. A suspended instance without either one is resumed on
+	// the next tick.
+	sleepTicks int
+	sleepUntil time.Time
+
+	// wakeTick is the absolute tick the scheduler resumes this instance at.
+	wakeTick uint64
+}
+
+type frame struct {
+	locals        []interface{}
+	returnAddress int
+}
+
+// RuntimeError is returned when a script fails during execution. Location describes where in the source the script
+// failed, if the binary has debug info.
+type RuntimeError struct {
+	Address  int
+	Location string
+	Message  string
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Location != "" {
+		return fmt.Sprintf("runtime error at %s: %s", e.Location, e.Message)
+	}
+
+	return fmt.Sprintf("runtime error at %04d: %s", e.Address, e.Message)
+}
+
+// NewInterpreter prepares a decoded binary for execution against the given runtime definition. The binary is checked
+// with Verify first, and rejected if it does not pass.
+func NewInterpreter(bin *Binary, runtime *AdderRuntime) (*Interpreter, error) {
+	if err := Verify(bin, runtime); err != nil {
+		return nil, err
+	}
+
+	interpreter := &Interpreter{
+		binary:     bin,
+		runtime:    runtime,
+		natives:    map[int]NativeFunc{},
+		getters:    map[int]FieldGetter{},
+		setters:    map[int]FieldSetter{},
+		methods:    map[int]NativeMethod{},
+		frameSizes: map[int]int{},
+	}
+
+	for _, v := range bin.Methods {
+		interpreter.frameSizes[v.Entry] = v.Locals
+	}
+
+	// Convert the constant pool to runtime values once, instead of on every push
+	for i, v := range bin.Constants {
+		switch v.Type {
+		case VarTypeInt:
+			interpreter.constants = append(interpreter.constants, int32(v.Value.(int)))
+		case VarTypeLong, VarTypeFloat, VarTypeString:
+			interpreter.constants = append(interpreter.constants, v.Value)
+		default:
+			return nil, fmt.Errorf("constant %d has unsupported type %s", i, v.Type.String())
+		}
+	}
+
+	for i, v := range bin.Globals {
+		switch x := v.Value.(type) {
+		case int:
+			interpreter.globals = append(interpreter.globals, int32(x))
+		case int64, float64, string:
+			interpreter.globals = append(interpreter.globals, x)
+		default:
+			return nil, fmt.Errorf("global %d (%s) has unsupported initial value %T", i, v.Name, v.Value)
+		}
+	}
+
+	return interpreter, nil
+}
+
+// PersistentGlobals returns the current values of the globals marked persist by name, for the host to save. The values
+// are in their stack representation, and are meant to be passed back to RestoreGlobals as they are.
+func (vm *Interpreter) PersistentGlobals() map[string]interface{} {
+	values := map[string]interface{}{}
+	for i, v := range vm.binary.Globals {
+		if v.Persist {
+			values[v.Name] = vm.globals[i]
+		}
+	}
+
+	return values
+}
+
+// RestoreGlobals sets persistent globals to the values saved from PersistentGlobals. Values of globals that no longer
+// exist or are no longer persistent are ignored, so saved state survives changes to the script. A value of another
+// type than the global is an error, in which case no global is changed.
+func (vm *Interpreter) RestoreGlobals(values map[string]interface{}) error {
+	restored := map[int]interface{}{}
+	for i, v := range vm.binary.Globals {
+		value, ok := values[v.Name]
+		if !ok || !v.Persist {
+			continue
+		}
+
+		if !sameStackType(value, vm.globals[i]) {
+			return fmt.Errorf("cannot restore global %s: got %T, expected %T", v.Name, value, vm.globals[i])
+		}
+		restored[i] = value
+	}
+
+	for i, value := range restored {
+		vm.globals[i] = value
+	}
+
+	return nil
+}
+
+// RegisterNative binds a host function to the runtime function with the given internal id.
+func (vm *Interpreter) RegisterNative(id int, fn NativeFunc) error {
+	if vm.runtime.FindFunctionById(id) == nil {
+		return fmt.Errorf("runtime does not define a function with id %d", id)
+	}
+
+	vm.natives[id] = fn
+	return nil
+}
+
+// RegisterNativeByName binds a host function to the runtime function with the given name.
+func (vm *Interpreter) RegisterNativeByName(name string, fn NativeFunc) error {
+	function := vm.runtime.FindFunction(name)
+	if function == nil {
+		return fmt.Errorf("runtime does not define a function named %s", name)
+	}
+
+	vm.natives[function.InternalId] = fn
+	return nil
+}
+
+// RegisterField binds host functions reading and writing the field with the given internal id. Either one may be nil,
+// in which case scripts accessing the field that way fail at runtime.
+func (vm *Interpreter) RegisterField(id int, get FieldGetter, set FieldSetter) error {
+	if _, field := vm.runtime.FindFieldById(id); field == nil {
+		return fmt.Errorf("runtime does not define a field with id %d", id)
+	}
+
+	vm.getters[id] = get
+	vm.setters[id] = set
+	return nil
+}
+
+// RegisterFieldByName binds host functions reading and writing a field of the given native type.
+func (vm *Interpreter) RegisterFieldByName(typeName string, name string, get FieldGetter, set FieldSetter) error {
+	typ := vm.runtime.FindType(typeName)
+	if typ == nil || typ.ResolveField(name) == nil {
+		return fmt.Errorf("runtime does not define a field named %s.%s", typeName, name)
+	}
+
+	return vm.RegisterField(typ.ResolveField(name).InternalId, get, set)
+}
+
+// RegisterMethod binds a host function to the native type method with the given internal id.
+func (vm *Interpreter) RegisterMethod(id int, fn NativeMethod) error {
+	if _, method := vm.runtime.FindMethodById(id); method == nil {
+		return fmt.Errorf("runtime does not define a method with id %d", id)
+	}
+
+	vm.methods[id] = fn
+	return nil
+}
+
+// RegisterMethodByName binds a host function to a method of the given native type.
+func (vm *Interpreter) RegisterMethodByName(typeName string, name string, fn NativeMethod) error {
+	typ := vm.runtime.FindType(typeName)
+	if typ == nil || typ.ResolveMethod(name) == nil {
+		return fmt.Errorf("runtime does not define a method named %s.%s", typeName, name)
+	}
+
+	return vm.RegisterMethod(typ.ResolveMethod(name).InternalId, fn)
+}
+
+// Dispatch runs every trigger listening to the given listener whose filter values match the passed values. The values
+// are those of the listener parameters, followed by those of its arguments, as Go types listed at toHostValue. Scripts
+// that suspend cannot be resumed without a scheduler, use Scheduler.Dispatch for those.
+func (vm *Interpreter) Dispatch(listenerId int, values ...interface{}) error {
+	instances, err := vm.Instances(listenerId, values...)
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range instances {
+		if err := instance.Run(); err != nil {
+			return err
+		}
+
+		if instance.Suspended() {
+			return instance.fail("script suspended outside of a scheduler")
+		}
+	}
+
+	return nil
+}
+
+// Instances creates a new script instance for every trigger matching the event, without running them. The event values
+// are placed in the first locals of each instance, where the trigger code expects them.
+func (vm *Interpreter) Instances(listenerId int, values ...interface{}) ([]*ScriptInstance, error) {
+	locals, err := vm.eventLocals(listenerId, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*ScriptInstance
+	for _, trigger := range vm.binary.Triggers {
+		if trigger.ListenerId == listenerId && triggerMatches(trigger, values) {
+			instance := vm.NewInstance(trigger.Address)
+			copy(instance.frames[0].locals, locals)
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances, nil
+}
+
+// eventLocals converts the values of an event to their stack representation, using the parameter and argument types
+// of the listener. Values beyond the ones the listener declares are ignored.
+func (vm *Interpreter) eventLocals(listenerId int, values []interface{}) ([]interface{}, error) {
+	listener := vm.runtime.FindListenerById(listenerId)
+	if listener == nil {
+		return nil, fmt.Errorf("runtime does not define a listener with id %d", listenerId)
+	}
+
+	declared := append(append([]FunctionParameter(nil), listener.Parameters...), listener.Arguments...)
+
+	var locals []interface{}
+	for i := 0; i < len(values) && i < len(declared); i++ {
+		value, err := fromHostValue(declared[i].Type, values[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s is %s, got %T", listener.Name, declared[i].Name, declared[i].Type.String(), values[i])
+		}
+		locals = append(locals, value)
+	}
+
+	return locals, nil
+}
+
+func triggerMatches(trigger *BinaryTrigger, values []interface{}) bool {
+	if len(trigger.Values) > len(values) {
+		return false
+	}
+
+	for i, v := range trigger.Values {
+		if pattern, ok := v.(Glob); ok {
+			if s, ok := values[i].(string); !ok || !matchGlob(string(pattern), s) {
+				return false
+			}
+			continue
+		}
+
+		a, aok := toInt64(v)
+		b, bok := toInt64(values[i])
+
+		if aok && bok {
+			if a != b {
+				return false
+			}
+		} else if v != values[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchGlob matches a string against a pattern in which * matches any run of characters and ? any single character.
+func matchGlob(pattern string, s string) bool {
+	// Position to retry from when a mismatch happens after a *, matching one more character with it
+	star, retry := -1, 0
+
+	p, i := 0, 0
+	for i < len(s) {
+		if p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]) {
+			p++
+			i++
+		} else if p < len(pattern) && pattern[p] == '*' {
+			star, retry = p, i
+			p++
+		} else if star >= 0 {
+			retry++
+			p, i = star+1, retry
+		} else {
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	default:
+		return 0, false
+	}
+}
+
+// NewInstance creates a script instance that starts executing at the given address once run.
+func (vm *Interpreter) NewInstance(address int) *ScriptInstance {
+	return &ScriptInstance{
+		interpreter: vm,
+		pc:          address,
+		frames:      []*frame{vm.newFrame(address, -1)},
+	}
+}
+
+// newFrame creates the frame for a method starting at the given address, with the local slots the method table lists
+// for it. Locals beyond those are added when they are first stored to.
+func (vm *Interpreter) newFrame(address int, returnAddress int) *frame {
+	return &frame{
+		locals:        make([]interface{}, vm.frameSizes[address]),
+		returnAddress: returnAddress,
+	}
+}
+
+// Finished returns true once the instance has returned from its outermost frame.
+func (s *ScriptInstance) Finished() bool {
+	return len(s.frames) == 0
+}
+
+// Suspended returns true if the instance is parked at a YIELD and waiting to be resumed.
+func (s *ScriptInstance) Suspended() bool {
+	return s.suspended
+}
+
+// SleepTicks asks for the instance to be resumed after the given number of game ticks. It is meant to be called
+// by suspending host functions; the script is parked at the YIELD following the call.
+func (s *ScriptInstance) SleepTicks(ticks int) {
+	s.sleepTicks = ticks
+	s.sleepUntil = time.Time{}
+}
+
+// SleepUntil asks for the instance to be resumed on the first tick at or after the given wall-clock time.
+func (s *ScriptInstance) SleepUntil(deadline time.Time) {
+	s.sleepTicks = 0
+	s.sleepUntil = deadline
+}
+
+// SleepFor asks for the instance to be resumed once the given duration has passed.
+func (s *ScriptInstance) SleepFor(d time.Duration) {
+	s.SleepUntil(time.Now().Add(d))
+}
+
+// Run executes the instance until it returns from its outermost frame, suspends, or until an error occurs. Running a
+// suspended instance resumes it after the YIELD it was parked at.
+func (s *ScriptInstance) Run() error {
+	code := s.interpreter.binary.Code
+	s.suspended = false
+
+	for !s.Finished() && !s.suspended {
+		if s.pc < 0 || s.pc >= len(code) {
+			return s.fail("program counter out of bounds")
+		}
+
+		if err := s.step(code[s.pc]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ScriptInstance) step(inst *Instruction) error {
+	next := s.pc + 1
+	operand := inst.cpoolIndex
+
+	switch inst.Opcode {
+	case op_pushconst:
+		if operand < 0 || operand >= len(s.interpreter.constants) {
+			return s.fail("constant pool index %d out of bounds", operand)
+		}
+		s.push(s.interpreter.constants[operand])
+	case op_jmp:
+		next = operand
+	case op_getlocal:
+		locals := s.currentFrame().locals
+		if operand < 0 || operand >= len(locals) || locals[operand] == nil {
+			return s.fail("read of unassigned local %d", operand)
+		}
+		s.push(locals[operand])
+	case op_getglobal:
+		if operand < 0 || operand >= len(s.interpreter.globals) {
+			return s.fail("read of unknown global %d", operand)
+		}
+		s.push(s.interpreter.globals[operand])
+	case op_setglobal:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+		if operand < 0 || operand >= len(s.interpreter.globals) {
+			return s.fail("write of unknown global %d", operand)
+		}
+		s.interpreter.globals[operand] = value
+	case op_pop:
+		if _, err := s.pop(); err != nil {
+			return err
+		}
+	case op_setlocal:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+		if operand < 0 {
+			return s.fail("negative local index %d", operand)
+		}
+
+		f := s.currentFrame()
+		for len(f.locals) <= operand {
+			f.locals = append(f.locals, nil)
+		}
+		f.locals[operand] = value
+	case op_return:
+		returning := s.frames[len(s.frames)-1]
+		s.frames = s.frames[:len(s.frames)-1]
+		next = returning.returnAddress
+	case op_jz:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+
+		condition, ok := value.(int32)
+		if !ok {
+			return s.fail("JZ expects an int on the stack, got %T", value)
+		}
+		if condition == 0 {
+			next = operand
+		}
+	case op_eq, op_neq:
+		right, left, err := s.pop2()
+		if err != nil {
+			return err
+		}
+
+		result, err := equal(left, right)
+		if err != nil {
+			return s.fail("%s", err)
+		}
+		s.push(boolToInt(result == (inst.Opcode == op_eq)))
+	case op_not:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+
+		b, ok := value.(int32)
+		if !ok {
+			return s.fail("NOT expects a bool on the stack, got %T", value)
+		}
+		s.push(boolToInt(b == 0))
+	case op_neg:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+
+		switch v := value.(type) {
+		case int32:
+			s.push(-v)
+		case int64:
+			s.push(-v)
+		case float64:
+			s.push(-v)
+		default:
+			return s.fail("cannot apply NEG to %T", value)
+		}
+	case op_concat:
+		right, left, err := s.pop2()
+		if err != nil {
+			return err
+		}
+
+		l, lok := left.(string)
+		r, rok := right.(string)
+		if !lok || !rok {
+			return s.fail("cannot apply CONCAT to %T and %T", left, right)
+		}
+		s.push(l + r)
+	case op_tostring:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+
+		text, err := toText(tostringTypes[operand], value)
+		if err != nil {
+			return s.fail("%s", err)
+		}
+		s.push(text)
+	case op_i2l, op_i2f, op_l2i, op_l2f, op_f2i, op_f2l:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+
+		result, err := convert(inst.Opcode, value)
+		if err != nil {
+			return s.fail("%s", err)
+		}
+		s.push(result)
+	case op_lt, op_le, op_gt, op_ge:
+		right, left, err := s.pop2()
+		if err != nil {
+			return err
+		}
+
+		result, err := compare(inst.Opcode, left, right)
+		if err != nil {
+			return s.fail("%s", err)
+		}
+		s.push(boolToInt(result))
+	case op_call:
+		s.frames = append(s.frames, s.interpreter.newFrame(operand, next))
+		next = operand
+	case op_nativecall:
+		if err := s.callNative(operand); err != nil {
+			return err
+		}
+	case op_getfield:
+		if err := s.getField(operand); err != nil {
+			return err
+		}
+	case op_setfield:
+		if err := s.setField(operand); err != nil {
+			return err
+		}
+	case op_invoke:
+		if err := s.invoke(operand); err != nil {
+			return err
+		}
+	case op_yield:
+		s.suspended = true
+	case op_add, op_sub, op_div, op_mul, op_mod:
+		right, left, err := s.pop2()
+		if err != nil {
+			return err
+		}
+
+		result, err := arithmetic(inst.Opcode, left, right)
+		if err != nil {
+			return s.fail("%s", err)
+		}
+		s.push(result)
+	default:
+		return s.fail("unknown opcode %d", inst.Opcode)
+	}
+
+	s.pc = next
+	return nil
+}
+
+func (s *ScriptInstance) callNative(id int) error {
+	function := s.interpreter.runtime.FindFunctionById(id)
+	if function == nil {
+		return s.fail("runtime does not define native function %d", id)
+	}
+
+	fn := s.interpreter.natives[id]
+	if fn == nil {
+		return s.fail("no host function registered for %s (id %d)", function.Name, id)
+	}
+
+	// Arguments are pushed in reverse, so the first parameter is on top of the stack.
+	args := make([]interface{}, len(function.Parameters))
+	for i, param := range function.Parameters {
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+		args[i] = toHostValue(param.Type, value)
+	}
+
+	result, err := fn(s, args)
+	if err != nil {
+		return s.fail("%s: %s", function.Name, err)
+	}
+
+	if function.ReturnType != VarTypeVoid {
+		value, err := fromHostValue(function.ReturnType, result)
+		if err != nil {
+			return s.fail("%s: %s", function.Name, err)
+		}
+		s.push(value)
+	}
+
+	return nil
+}
+
+// popReceiver pops the native object a member is accessed on.
+func (s *ScriptInstance) popReceiver(typ *BaseType, member string) (interface{}, error) {
+	receiver, err := s.pop()
+	if err != nil {
+		return nil, err
+	}
+
+	if receiver == nil {
+		return nil, s.fail("cannot access %s.%s of nil", typ.Name, member)
+	}
+
+	return receiver, nil
+}
+
+func (s *ScriptInstance) getField(id int) error {
+	typ, field := s.interpreter.runtime.FindFieldById(id)
+	if field == nil {
+		return s.fail("runtime does not define field %d", id)
+	}
+
+	get := s.interpreter.getters[id]
+	if get == nil {
+		return s.fail("no host getter registered for %s.%s (id %d)", typ.Name, field.Name, id)
+	}
+
+	receiver, err := s.popReceiver(typ, field.Name)
+	if err != nil {
+		return err
+	}
+
+	result, err := get(s, receiver)
+	if err != nil {
+		return s.fail("%s.%s: %s", typ.Name, field.Name, err)
+	}
+
+	value, err := fromHostValue(field.Type, result)
+	if err != nil {
+		return s.fail("%s.%s: %s", typ.Name, field.Name, err)
+	}
+
+	s.push(value)
+	return nil
+}
+
+func (s *ScriptInstance) setField(id int) error {
+	typ, field := s.interpreter.runtime.FindFieldById(id)
+	if field == nil {
+		return s.fail("runtime does not define field %d", id)
+	}
+
+	set := s.interpreter.setters[id]
+	if set == nil {
+		return s.fail("no host setter registered for %s.%s (id %d)", typ.Name, field.Name, id)
+	}
+
+	receiver, err := s.popReceiver(typ, field.Name)
+	if err != nil {
+		return err
+	}
+
+	value, err := s.pop()
+	if err != nil {
+		return err
+	}
+
+	if err := set(s, receiver, toHostValue(field.Type, value)); err != nil {
+		return s.fail("%s.%s: %s", typ.Name, field.Name, err)
+	}
+
+	return nil
+}
+
+func (s *ScriptInstance) invoke(id int) error {
+	typ, method := s.interpreter.runtime.FindMethodById(id)
+	if method == nil {
+		return s.fail("runtime does not define method %d", id)
+	}
+
+	fn := s.interpreter.methods[id]
+	if fn == nil {
+		return s.fail("no host method registered for %s.%s (id %d)", typ.Name, method.Name, id)
+	}
+
+	receiver, err := s.popReceiver(typ, method.Name)
+	if err != nil {
+		return err
+	}
+
+	args := make([]interface{}, len(method.Parameters))
+	for i, param := range method.Parameters {
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+		args[i] = toHostValue(param.Type, value)
+	}
+
+	result, err := fn(s, receiver, args)
+	if err != nil {
+		return s.fail("%s.%s: %s", typ.Name, method.Name, err)
+	}
+
+	if method.Returns != VarTypeVoid {
+		value, err := fromHostValue(method.Returns, result)
+		if err != nil {
+			return s.fail("%s.%s: %s", typ.Name, method.Name, err)
+		}
+		s.push(value)
+	}
+
+	return nil
+}
+
+// toHostValue converts a stack value to the Go type a host function receives for a parameter type: int32 for int,
+// int64 for long, float64 for float, string for string, bool for bool and the untouched host value for native types.
+func toHostValue(typ VariableType, value interface{}) interface{} {
+	if typ == VarTypeBool {
+		return value != int32(0)
+	}
+
+	return value
+}
+
+// fromHostValue converts a value returned by a host function back to its stack representation.
+func fromHostValue(typ VariableType, value interface{}) (interface{}, error) {
+	switch typ {
+	case VarTypeBool:
+		if b, ok := value.(bool); ok {
+			return boolToInt(b), nil
+		}
+	case VarTypeInt:
+		switch x := value.(type) {
+		case int32:
+			return x, nil
+		case int:
+			return int32(x), nil
+		}
+	case VarTypeLong:
+		if x, ok := toInt64(value); ok {
+			return x, nil
+		}
+	case VarTypeFloat:
+		switch x := value.(type) {
+		case float64:
+			return x, nil
+		case float32:
+			return float64(x), nil
+		}
+	case VarTypeString:
+		if x, ok := value.(string); ok {
+			return x, nil
+		}
+	default:
+		if !typ.builtin {
+			return value, nil
+		}
+	}
+
+	return nil, fmt.Errorf("host function returned %T, expected %s", value, typ.String())
+}
+
+// equal compares two stack values for EQ. Host values are compared with ==, which does not work for values such as
+// slices, maps and funcs; comparing those is reported instead.
+func equal(left, right interface{}) (bool, error) {
+	for _, v := range []interface{}{left, right} {
+		if v != nil && !reflect.TypeOf(v).Comparable() {
+			return false, fmt.Errorf("cannot compare host values of type %T", v)
+		}
+	}
+
+	return left == right, nil
+}
+
+// sameStackType checks whether two stack values have the same Go type.
+func sameStackType(a, b interface{}) bool {
+	switch a.(type) {
+	case int32:
+		_, ok := b.(int32)
+		return ok
+	case int64:
+		_, ok := b.(int64)
+		return ok
+	case float64:
+		_, ok := b.(float64)
+		return ok
+	case string:
+		_, ok := b.(string)
+		return ok
+	}
+
+	return false
+}
+
+func arithmetic(op Opcode, left, right interface{}) (interface{}, error) {
+	switch l := left.(type) {
+	case int32:
+		r, ok := right.(int32)
+		if !ok {
+			break
+		}
+		if (op == op_div || op == op_mod) && r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+
+		switch op {
+		case op_add:
+			return l + r, nil
+		case op_sub:
+			return l - r, nil
+		case op_mul:
+			return l * r, nil
+		case op_div:
+			return l / r, nil
+		case op_mod:
+			return l % r, nil
+		}
+	case int64:
+		r, ok := right.(int64)
+		if !ok {
+			break
+		}
+		if (op == op_div || op == op_mod) && r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+
+		switch op {
+		case op_add:
+			return l + r, nil
+		case op_sub:
+			return l - r, nil
+		case op_mul:
+			return l * r, nil
+		case op_div:
+			return l / r, nil
+		case op_mod:
+			return l % r, nil
+		}
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			break
+		}
+		if (op == op_div || op == op_mod) && r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+
+		switch op {
+		case op_add:
+			return l + r, nil
+		case op_sub:
+			return l - r, nil
+		case op_mul:
+			return l * r, nil
+		case op_div:
+			return l / r, nil
+		case op_mod:
+			return math.Mod(l, r), nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot apply %s to %T and %T", op.Mnemonic(), left, right)
+}
+
+// toText converts a value of the given type to the text TOSTRING pushes for it. Floats are written the way they would
+// be in a script, so they can be told apart from ints.
+func toText(typ VariableType, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case int32:
+		if typ == VarTypeBool {
+			return strconv.FormatBool(v != 0), nil
+		} else if typ == VarTypeInt {
+			return strconv.FormatInt(int64(v), 10), nil
+		}
+	case int64:
+		if typ == VarTypeLong {
+			return strconv.FormatInt(v, 10), nil
+		}
+	case float64:
+		if typ == VarTypeFloat {
+			return formatFloat(v), nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot apply TOSTRING for %s to %T", typ.String(), value)
+}
+
+// convert applies a conversion opcode to a number. Longs are narrowed to ints by dropping the high bits. Floats are
+// truncated towards zero, clamped to the range of the target type, and NaN becomes zero.
+func convert(op Opcode, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int32:
+		switch op {
+		case op_i2l:
+			return int64(v), nil
+		case op_i2f:
+			return float64(v), nil
+		}
+	case int64:
+		switch op {
+		case op_l2i:
+			return int32(v), nil
+		case op_l2f:
+			return float64(v), nil
+		}
+	case float64:
+		switch {
+		case op == op_f2i && math.IsNaN(v):
+			return int32(0), nil
+		case op == op_f2i && v >= math.MaxInt32:
+			return int32(math.MaxInt32), nil
+		case op == op_f2i && v <= math.MinInt32:
+			return int32(math.MinInt32), nil
+		case op == op_f2i:
+			return int32(v), nil
+		case op == op_f2l && math.IsNaN(v):
+			return int64(0), nil
+		case op == op_f2l && v >= math.MaxInt64:
+			return int64(math.MaxInt64), nil
+		case op == op_f2l && v <= math.MinInt64:
+			return int64(math.MinInt64), nil
+		case op == op_f2l:
+			return int64(v), nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot apply %s to %T", op.Mnemonic(), value)
+}
+
+// compare applies a relational opcode to two values of the same numeric type.
+func compare(op Opcode, left, right interface{}) (bool, error) {
+	var l, r int64
+	switch lv := left.(type) {
+	case int32:
+		rv, ok := right.(int32)
+		if !ok {
+			return false, fmt.Errorf("cannot apply %s to %T and %T", op.Mnemonic(), left, right)
+		}
+		l, r = int64(lv), int64(rv)
+	case int64:
+		rv, ok := right.(int64)
+		if !ok {
+			return false, fmt.Errorf("cannot apply %s to %T and %T", op.Mnemonic(), left, right)
+		}
+		l, r = lv, rv
+	case float64:
+		rv, ok := right.(float64)
+		if !ok {
+			return false, fmt.Errorf("cannot apply %s to %T and %T", op.Mnemonic(), left, right)
+		}
+		return compareFloats(op, lv, rv), nil
+	default:
+		return false, fmt.Errorf("cannot apply %s to %T and %T", op.Mnemonic(), left, right)
+	}
+
+	switch op {
+	case op_lt:
+		return l < r, nil
+	case op_le:
+		return l <= r, nil
+	case op_gt:
+		return l > r, nil
+	default:
+		return l >= r, nil
+	}
+}
+
+// compareFloats applies a relational opcode to two floats. Every comparison involving NaN is false.
+func compareFloats(op Opcode, l, r float64) bool {
+	switch op {
+	case op_lt:
+		return l < r
+	case op_le:
+		return l <= r
+	case op_gt:
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+func boolToInt(b bool) int32 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func (s *ScriptInstance) currentFrame() *frame {
+	return s.frames[len(s.frames)-1]
+}
+
+func (s *ScriptInstance) push(value interface{}) {
+	s.stack = append(s.stack, value)
+}
+
+func (s *ScriptInstance) pop() (interface{}, error) {
+	if len(s.stack) == 0 {
+		return nil, s.fail("operand stack underflow")
+	}
+
+	value := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	return value, nil
+}
+
+// pop2 pops the two operands of a binary operation. The right-hand operand is on top of the stack.
+func (s *ScriptInstance) pop2() (interface{}, interface{}, error) {
+	right, err := s.pop()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	left, err := s.pop()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return right, left, nil
+}
+
+func (s *ScriptInstance) fail(format string, args ...interface{}) error {
+	return &RuntimeError{Address: s.pc, Location: s.interpreter.binary.Locate(s.pc), Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,1004 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRuntime is the runtime definition the tests compile scripts against.
+const testRuntime = `
+void println(string line) -> 1;
+suspend void sleep(int ticks) -> 2;
+native<Handle> handle(int id) -> 3;
+void println(int value) -> 4;
+void println(bool value) -> 6;
+void println(float value) -> 8;
+native<Player> player(int id) -> 7;
+
+type Handle {
+	readonly int id -> 1;
+}
+
+type Player {
+	string name -> 2;
+	readonly int id -> 3;
+	void teleport(int x, int z) -> 1;
+}
+
+const int ANSWER = 42;
+const string DOOR_PREFIX = "obj_door_";
+
+listener program_start() -> 1;
+listener number_typed(int number) -> 2;
+listener object_interact(string name, int option) -> 3;
+listener player_moved(int x, int z)(native<Player> player) -> 4;
+`
+
+// testScript is a compiled script, with println bound to collect its output.
+type testScript struct {
+	vm     *Interpreter
+	output []string
+}
+
+// compileScript compiles a script against the test runtime.
+func compileScript(t *testing.T, source string) *Assembler {
+	t.Helper()
+
+	runtime, err := ParseRuntime(testRuntime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assembler, diagnostics := Compile(runtime, "test.adr", source)
+	if HasErrors(diagnostics) {
+		t.Fatalf("compile failed: %v", diagnostics)
+	}
+
+	return assembler
+}
+
+// compileErrors compiles a script that is expected to fail, and returns its diagnostics.
+func compileErrors(t *testing.T, source string) []Diagnostic {
+	t.Helper()
+
+	runtime, err := ParseRuntime(testRuntime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, diagnostics := Compile(runtime, "test.adr", source)
+	if !HasErrors(diagnostics) {
+		t.Fatalf("compiled without errors:\n%s", source)
+	}
+
+	return diagnostics
+}
+
+// loadScript compiles a script, and runs the result through Encode and Decode the way a host would load it.
+func loadScript(t *testing.T, source string) *testScript {
+	t.Helper()
+
+	assembler := compileScript(t, source)
+	bin, err := Decode(assembler.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := NewInterpreter(bin, assembler.program.runtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := &testScript{vm: vm}
+	for _, id := range []int{1, 4, 6, 8} {
+		vm.RegisterNative(id, func(s *ScriptInstance, args []interface{}) (interface{}, error) {
+			script.output = append(script.output, fmt.Sprint(args[0]))
+			return nil, nil
+		})
+	}
+	vm.RegisterNativeByName("sleep", func(s *ScriptInstance, args []interface{}) (interface{}, error) {
+		s.SleepTicks(int(args[0].(int32)))
+		return nil, nil
+	})
+
+	return script
+}
+
+// expectOutput checks the lines printed so far.
+func (s *testScript) expectOutput(t *testing.T, expected ...string) {
+	t.Helper()
+
+	if strings.Join(s.output, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("printed %q, expected %q", s.output, expected)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	script := loadScript(t, `
+on number_typed(7) {
+	int a = 7;
+	println(a + 3 * 2);
+	println((a + 3) * 2);
+	println(a / 2 - 1);
+	println("text");
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "13", "20", "2", "text")
+}
+
+func TestCallsAndLocals(t *testing.T) {
+	script := loadScript(t, `
+func show(int value, string label) {
+	int doubled = value * 2;
+	println(label);
+	println(doubled);
+}
+
+on number_typed(1) {
+	int value = 5;
+	show(value + 1, "first");
+	show(value, "second");
+	println(value);
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "first", "12", "second", "10", "5")
+}
+
+func TestTriggerFilter(t *testing.T) {
+	script := loadScript(t, `
+on number_typed(1) {
+	println("one");
+}
+
+on number_typed(2) {
+	println("two");
+}
+`)
+
+	for _, number := range []int32{2, 3, 1} {
+		if err := script.vm.Dispatch(2, number); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script.expectOutput(t, "two", "one")
+}
+
+func TestUninitializedLocals(t *testing.T) {
+	script := loadScript(t, `
+on number_typed(1) {
+	int i;
+	long l;
+	string s;
+	bool b;
+	println(i);
+	println(s);
+	println(b);
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "0", "", "false")
+}
+
+func TestEqualHostValues(t *testing.T) {
+	script := loadScript(t, `
+on number_typed(1) {
+	if (handle(1) == handle(1)) {
+		println("same");
+	}
+	if (handle(1) == handle(2)) {
+		println("wrong");
+	}
+}
+`)
+
+	// Pointers are compared by identity
+	handles := map[int32]*int32{}
+	script.vm.RegisterNativeByName("handle", func(s *ScriptInstance, args []interface{}) (interface{}, error) {
+		id := args[0].(int32)
+		if handles[id] == nil {
+			handles[id] = &id
+		}
+		return handles[id], nil
+	})
+
+	if err := script.vm.Dispatch(2, int32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "same")
+
+	// Slices cannot be compared, which has to fail the script rather than panic
+	script.vm.RegisterNativeByName("handle", func(s *ScriptInstance, args []interface{}) (interface{}, error) {
+		return []int32{args[0].(int32)}, nil
+	})
+
+	err := script.vm.Dispatch(2, int32(1))
+	if _, ok := err.(*RuntimeError); !ok {
+		t.Fatalf("expected a runtime error, got %v", err)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	script := loadScript(t, `
+on number_typed(1) {
+	int i = 0;
+	while (true) {
+		i = i + 1;
+		if (i == 2) {
+			continue;
+		}
+		if (i == 5) {
+			break;
+		}
+		println(i);
+	}
+
+	bool more = true;
+	for (int j = 10; more; j = j + 1) {
+		more = false;
+		if (j == 11) {
+			more = true;
+			continue;
+		}
+		if (j == 10) {
+			more = true;
+		}
+		println(j);
+	}
+
+	int k = 0;
+	for (;;) {
+		k = k + 1;
+		if (k == 3) {
+			break;
+		}
+	}
+	println(k);
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "1", "3", "4", "10", "12", "3")
+
+	for _, source := range []string{
+		"on number_typed(1) { break; }",
+		"on number_typed(1) { if (true) { continue; } }",
+		"func helper() { break; }\non number_typed(1) { while (true) { helper(); } }",
+	} {
+		diagnostics := compileErrors(t, source)
+		if diagnostics[0].Code != ErrBranchOutsideLoop {
+			t.Errorf("expected %s for %q, got %v", ErrBranchOutsideLoop, source, diagnostics)
+		}
+	}
+}
+
+func TestReturns(t *testing.T) {
+	script := loadScript(t, `
+func int add(int a, int b) {
+	return a + b;
+}
+
+func int sign(int value) {
+	if (value == 0) {
+		return 0;
+	} else {
+		return 1;
+	}
+}
+
+func int first_multiple(int step) {
+	int value = 0;
+	while (true) {
+		value = value + step;
+		if (value == step * 3) {
+			return value;
+		}
+	}
+}
+
+func void report(int value) {
+	if (value == 0) {
+		return;
+	}
+	println(value);
+}
+
+on number_typed(1) {
+	println(add(2, add(3, 4)) * 2);
+	println(sign(0) + sign(5));
+	println(first_multiple(4));
+	report(0);
+	report(7);
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "18", "1", "12", "7")
+
+	for _, test := range []struct {
+		source string
+		code   DiagnosticCode
+	}{
+		{"func int none() { }", ErrMissingReturn},
+		{"func int half(int value) { if (value == 0) { return 0; } }", ErrMissingReturn},
+		{"func int looping() { while (true) { break; } }", ErrMissingReturn},
+		{`func int text() { return "a"; }`, ErrTypeMismatch},
+		{"func int empty() { return; }", ErrTypeMismatch},
+		{"func void nothing() { return 1; }", ErrTypeMismatch},
+		{"func void nothing() { }\non number_typed(1) { int x = nothing(); }", ErrTypeMismatch},
+	} {
+		diagnostics := compileErrors(t, test.source)
+		if diagnostics[0].Code != test.code {
+			t.Errorf("expected %s for %q, got %v", test.code, test.source, diagnostics)
+		}
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	script := loadScript(t, `
+func void compare(int a, int b) {
+	println(a < b);
+	println(a <= b);
+	println(a > b);
+	println(a >= b);
+	println(a != b);
+}
+
+on number_typed(1) {
+	compare(1, 2);
+	compare(2, 2);
+	println(handle(1) != handle(1));
+	println("a" != "b");
+	println(true != false);
+	println(5000000000 > 4000000000);
+}
+`)
+
+	script.vm.RegisterNativeByName("handle", func(s *ScriptInstance, args []interface{}) (interface{}, error) {
+		return "handle", nil
+	})
+
+	if err := script.vm.Dispatch(2, int32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t,
+		"true", "true", "false", "false", "true",
+		"false", "true", "false", "true", "false",
+		"false", "true", "true", "true")
+
+	for _, source := range []string{
+		`on number_typed(1) { println("a" < "b"); }`,
+		"on number_typed(1) { println(true > false); }",
+		"on number_typed(1) { int x = 1 < 2; }",
+	} {
+		compileErrors(t, source)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	script := loadScript(t, `
+func bool check(int id, bool result) {
+	println(id);
+	return result;
+}
+
+on number_typed(1) {
+	println(check(1, false) && check(2, true));
+	println(check(3, true) && check(4, false));
+	println(check(5, true) || check(6, false));
+	println(check(7, false) || check(8, true));
+	println(!check(9, false) && !(1 > 2));
+	int value = 4;
+	println(-value + 10);
+	println(-(value * 2));
+	println(-5000000000 < 4000000000);
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t,
+		"1", "false",
+		"3", "4", "false",
+		"5", "true",
+		"7", "8", "true",
+		"9", "true",
+		"6", "-8", "true")
+
+	for _, source := range []string{
+		"on number_typed(1) { println(1 && true); }",
+		"on number_typed(1) { println(true || 2); }",
+		"on number_typed(1) { println(!1); }",
+		"on number_typed(1) { println(-true); }",
+		`on number_typed(1) { println(-"a"); }`,
+	} {
+		compileErrors(t, source)
+	}
+}
+
+func TestMemberAccess(t *testing.T) {
+	script := loadScript(t, `
+on number_typed(1) {
+	Player p = player(1);
+	println(p.name);
+	println(p.id);
+	p.name = "renamed";
+	println(player(1).name);
+	p.teleport(3, 4);
+	native<Player> other = player(2);
+	other.teleport(5, 6);
+}
+`)
+
+	type testPlayer struct {
+		name string
+		x, z int32
+	}
+
+	players := map[int32]*testPlayer{1: {name: "first"}, 2: {name: "second"}}
+	script.vm.RegisterNativeByName("player", func(s *ScriptInstance, args []interface{}) (interface{}, error) {
+		return players[args[0].(int32)], nil
+	})
+	script.vm.RegisterFieldByName("Player", "name", func(s *ScriptInstance, receiver interface{}) (interface{}, error) {
+		return receiver.(*testPlayer).name, nil
+	}, func(s *ScriptInstance, receiver interface{}, value interface{}) error {
+		receiver.(*testPlayer).name = value.(string)
+		return nil
+	})
+	script.vm.RegisterFieldByName("Player", "id", func(s *ScriptInstance, receiver interface{}) (interface{}, error) {
+		for id, p := range players {
+			if p == receiver {
+				return id, nil
+			}
+		}
+		return int32(0), nil
+	}, nil)
+	script.vm.RegisterMethodByName("Player", "teleport", func(s *ScriptInstance, receiver interface{}, args []interface{}) (interface{}, error) {
+		receiver.(*testPlayer).x, receiver.(*testPlayer).z = args[0].(int32), args[1].(int32)
+		return nil, nil
+	})
+
+	if err := script.vm.Dispatch(2, int32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "first", "1", "renamed")
+	if p := players[1]; p.x != 3 || p.z != 4 {
+		t.Errorf("expected player 1 at 3, 4, got %d, %d", p.x, p.z)
+	}
+	if p := players[2]; p.x != 5 || p.z != 6 {
+		t.Errorf("expected player 2 at 5, 6, got %d, %d", p.x, p.z)
+	}
+
+	for _, test := range []struct {
+		source string
+		code   DiagnosticCode
+	}{
+		{"on number_typed(1) { println(player(1).age); }", ErrUnknownMember},
+		{"on number_typed(1) { player(1).jump(); }", ErrUnknownMember},
+		{"on number_typed(1) { int x = 1; println(x.name); }", ErrUnknownMember},
+		{"on number_typed(1) { player(1).name = 1; }", ErrTypeMismatch},
+		{"on number_typed(1) { player(1).teleport(true, 0); }", ErrUnresolvedMethod},
+		{"on number_typed(1) { player(1).teleport(1); }", ErrUnresolvedMethod},
+		{"on number_typed(1) { player(1).id = 2; }", ErrReadOnlyField},
+		{"on number_typed(1) { Handle h; }", ErrUninitializedVariable},
+		{"on number_typed(1) { Door d = player(1); }", ErrUnresolvedType},
+	} {
+		diagnostics := compileErrors(t, test.source)
+		if diagnostics[0].Code != test.code {
+			t.Errorf("expected %s for %q, got %v", test.code, test.source, diagnostics)
+		}
+	}
+}
+
+func TestTriggerGlobs(t *testing.T) {
+	script := loadScript(t, `
+on object_interact("obj_door_*") {
+	println("door");
+}
+
+on object_interact("obj_?ate") {
+	println("gate");
+}
+
+on object_interact("obj_lever" | "obj_switch", 2 | 3) {
+	println("pulled");
+}
+
+on number_typed(4 | 5) {
+	println("four or five");
+}
+`)
+
+	for _, event := range []struct {
+		name   string
+		option int32
+	}{
+		{"obj_door_front", 1},
+		{"obj_door_", 1},
+		{"obj_gate", 1},
+		{"obj_late", 1},
+		{"obj_grate", 1},
+		{"obj_lever", 2},
+		{"obj_switch", 3},
+		{"obj_lever", 4},
+		{"obj_window", 1},
+		{"my_obj_door_1", 1},
+	} {
+		if err := script.vm.Dispatch(3, event.name, event.option); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, number := range []int32{3, 4, 5, 6} {
+		if err := script.vm.Dispatch(2, number); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script.expectOutput(t, "door", "door", "gate", "gate", "pulled", "pulled", "four or five", "four or five")
+}
+
+func TestTriggerParameters(t *testing.T) {
+	script := loadScript(t, `
+on number_typed(int number) {
+	println(number * 2);
+}
+
+on object_interact("obj_door", int option) {
+	println(option);
+}
+
+on player_moved(0, int z)(Player mover) {
+	println(mover.name);
+	println(z);
+}
+`)
+
+	script.vm.RegisterFieldByName("Player", "name", func(s *ScriptInstance, receiver interface{}) (interface{}, error) {
+		return receiver.(string), nil
+	}, nil)
+
+	if err := script.vm.Dispatch(2, int32(21)); err != nil {
+		t.Fatal(err)
+	}
+	if err := script.vm.Dispatch(3, "obj_door", int32(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := script.vm.Dispatch(3, "obj_gate", int32(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := script.vm.Dispatch(4, int32(0), int32(7), "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := script.vm.Dispatch(4, int32(1), int32(8), "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "42", "4", "alice", "7")
+
+	for _, test := range []struct {
+		source string
+		code   DiagnosticCode
+	}{
+		{"on number_typed(string number) { }", ErrTypeMismatch},
+		{"on number_typed(long number) { }", ErrTypeMismatch},
+		{"on object_interact(int name) { }", ErrTypeMismatch},
+		{"on number_typed(int number, int other) { }", ErrInvalidTriggerValue},
+		{"on player_moved(0, 0)(Player mover, int extra) { }", ErrInvalidTriggerValue},
+		{"on player_moved(0, 0)(Handle mover) { }", ErrTypeMismatch},
+		{"on player_moved(int x, int x) { }", ErrRedeclaredVariable},
+		{"on number_typed(thing number) { }", ErrUnresolvedType},
+	} {
+		diagnostics := compileErrors(t, test.source)
+		if diagnostics[0].Code != test.code {
+			t.Errorf("expected %s for %q, got %v", test.code, test.source, diagnostics)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	script := loadScript(t, `
+const int LIMIT = ANSWER;
+const long BIG = 5000000000;
+const string GATE = "obj_gate";
+const bool ENABLED = true;
+
+on number_typed(ANSWER) {
+	println(LIMIT + 1);
+	println(BIG > 4000000000);
+	println(GATE);
+	println(ENABLED);
+}
+
+on object_interact(GATE) {
+	println(DOOR_PREFIX);
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(42)); err != nil {
+		t.Fatal(err)
+	}
+	if err := script.vm.Dispatch(3, "obj_gate", int32(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "43", "true", "obj_gate", "true", "obj_door_")
+
+	for _, test := range []struct {
+		source string
+		code   DiagnosticCode
+	}{
+		{"const int A = 1;\non number_typed(1) { A = 2; }", ErrAssignToConstant},
+		{"on number_typed(1) { ANSWER = 2; }", ErrAssignToConstant},
+		{"const int A = B;\nconst int B = 1;", ErrUndefinedVariable},
+		{`const int A = "text";`, ErrTypeMismatch},
+		{"const int A = 1;\nconst int A = 2;", ErrRedeclaredVariable},
+		{"const int A = 1 + 2;", ErrUnexpectedToken},
+	} {
+		diagnostics := compileErrors(t, test.source)
+		if diagnostics[0].Code != test.code {
+			t.Errorf("expected %s for %q, got %v", test.code, test.source, diagnostics)
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	source := `
+int count;
+persist long total = 5000000000;
+persist string last = "none";
+bool seen = false;
+
+on number_typed(1) {
+	count = count + 1;
+	total = total + 5000000000;
+	println(count);
+	println(last);
+	last = "one";
+	seen = true;
+}
+
+on number_typed(2) {
+	println(count);
+	println(total == 15000000000);
+	println(seen);
+}
+`
+	script := loadScript(t, source)
+	for _, number := range []int32{1, 1, 2} {
+		if err := script.vm.Dispatch(2, number); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script.expectOutput(t, "1", "none", "2", "one", "2", "true", "true")
+
+	saved := script.vm.PersistentGlobals()
+	if len(saved) != 2 || saved["total"] != int64(15000000000) || saved["last"] != "one" {
+		t.Fatalf("unexpected persistent globals %v", saved)
+	}
+
+	// A restarted script starts from its initial values, except for the persistent globals restored into it
+	restarted := loadScript(t, source)
+	if err := restarted.vm.RestoreGlobals(saved); err != nil {
+		t.Fatal(err)
+	}
+	for _, number := range []int32{1, 2} {
+		if err := restarted.vm.Dispatch(2, number); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restarted.expectOutput(t, "1", "one", "1", "false", "true")
+
+	if err := restarted.vm.RestoreGlobals(map[string]interface{}{"total": "text"}); err == nil {
+		t.Error("expected restoring a value of the wrong type to fail")
+	}
+
+	for _, test := range []struct {
+		source string
+		code   DiagnosticCode
+	}{
+		{"Handle h;", ErrTypeMismatch},
+		{`int count = "text";`, ErrTypeMismatch},
+		{"int count = 1;\nint count = 2;", ErrRedeclaredVariable},
+		{"on number_typed(1) { missing = 1; }", ErrUndefinedVariable},
+	} {
+		diagnostics := compileErrors(t, test.source)
+		if diagnostics[0].Code != test.code {
+			t.Errorf("expected %s for %q, got %v", test.code, test.source, diagnostics)
+		}
+	}
+}
+
+func TestFloats(t *testing.T) {
+	script := loadScript(t, `
+on program_start() {
+	float a = 1.5;
+	float b = 0.25;
+	float unset;
+	println(a + b);
+	println(a * b - 1.0);
+	println(a / b);
+	println(7.5 % 2.0);
+	println(-a);
+	println(a > b);
+	println(a == 1.5);
+	println(unset);
+}
+`)
+
+	if err := script.vm.Dispatch(1); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "1.75", "-0.625", "6", "1.5", "-1.5", "true", "true", "0")
+
+	for _, source := range []string{
+		"on program_start() { bool b = 1.5; }",
+		"on program_start() { float f = 1.5 + true; }",
+	} {
+		diagnostics := compileErrors(t, source)
+		if diagnostics[0].Code != ErrTypeMismatch {
+			t.Errorf("%s: unexpected diagnostics %v", source, diagnostics)
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	script := loadScript(t, `
+func long twice(long value) {
+	return value * 2;
+}
+
+on number_typed(int number) {
+	long big = 5;
+	float f = number;
+	println(big + number == 12);
+	println(f / 2.0);
+	println(twice(number) == 14);
+	println((int) 5000000000);
+	println((int) 7.9);
+	println((int) -7.9);
+	println((float) number / 2);
+	println((int) (number * 1.5));
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "true", "3.5", "true", "705032704", "7", "-7", "3.5", "10")
+
+	for _, source := range []string{
+		"on program_start() { int i = 5000000000; }",
+		"on program_start() { long l = 1; int i = l; }",
+		"on program_start() { float f = 1.5; long l = f; }",
+		"on program_start() { int i = 1.5; }",
+		"on program_start() { long l = 1; float f = 1.5; float x = l + f; }",
+		"func int narrow(long value) { return value; }",
+	} {
+		diagnostics := compileErrors(t, source)
+		if diagnostics[0].Code != ErrNarrowingConversion {
+			t.Errorf("%s: expected %s, got %v", source, ErrNarrowingConversion, diagnostics)
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	script := loadScript(t, `
+func string greet(string name) {
+	return "Hello ${name}!";
+}
+
+on number_typed(int number) {
+	long big = 5000000000;
+	float half = number / 2.0;
+	float unset;
+	println(greet("alice") + " " + number + " " + big + " " + half + " " + unset + " " + (number > 3));
+	println("${number}${""} and ${"nested ${number + 1}"} ${greet("${number}")}");
+	println(1 + 2 + "x" + (1 + 2));
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "Hello alice! 7 5000000000 3.5 0.0 true", "7 and nested 8 Hello 7!", "3x3")
+
+	for _, source := range []string{
+		`on program_start() { println("a" + handle(1)); }`,
+		`on program_start() { println("a ${handle(1)}"); }`,
+		`on program_start() { int x = "a" + 1; }`,
+		`on program_start() { println("a ${1 + }"); }`,
+	} {
+		compileErrors(t, source)
+	}
+}
+
+func TestRuntimeErrorLocation(t *testing.T) {
+	script := loadScript(t, `
+func int divide(int a, int b) {
+	return a / b;
+}
+
+on number_typed(int number) {
+	println(divide(10, number));
+}
+`)
+
+	err := script.vm.Dispatch(2, int32(0))
+	if err == nil || !strings.Contains(err.Error(), "test.adr:3 in divide") {
+		t.Fatalf("expected a runtime error located in divide, got %v", err)
+	}
+}
+
+func TestRecursion(t *testing.T) {
+	script := loadScript(t, `
+func int factorial(int n) {
+	if (n <= 1) {
+		return 1;
+	}
+	return n * factorial(n - 1);
+}
+
+func bool is_even(int n) {
+	if (n == 0) {
+		return true;
+	}
+	return is_odd(n - 1);
+}
+
+func bool is_odd(int n) {
+	if (n == 0) {
+		return false;
+	}
+	return is_even(n - 1);
+}
+
+on number_typed(int number) {
+	println(factorial(number));
+	println(is_even(number));
+	println(is_odd(number));
+}
+`)
+
+	if err := script.vm.Dispatch(2, int32(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "3628800", "true", "false")
+}
+
+func TestCallArguments(t *testing.T) {
+	for _, call := range []string{"add(1)", "add(1, 2, 3)", `add(1, "2")`, "add(true, 2)"} {
+		diagnostics := compileErrors(t, `
+func int add(int a, int b) {
+	return a + b;
+}
+
+on program_start() {
+	println(`+call+`);
+}
+`)
+		if diagnostics[0].Code != ErrUnresolvedMethod || !strings.Contains(diagnostics[0].Message, "cannot call add(int, int)") {
+			t.Errorf("%s: expected %s, got %v", call, ErrUnresolvedMethod, diagnostics)
+		}
+	}
+}
+
+func TestDiscardedResults(t *testing.T) {
+	script := loadScript(t, `
+int calls = 0;
+
+func int count() {
+	calls = calls + 1;
+	return calls;
+}
+
+on program_start() {
+	for (int i = 0; i < 3; i = i + 1) {
+		count();
+		handle(i);
+		i + 1;
+		println("discarded");
+	}
+	println(calls);
+}
+`)
+
+	script.vm.RegisterNativeByName("handle", func(s *ScriptInstance, args []interface{}) (interface{}, error) {
+		return args[0], nil
+	})
+
+	if err := script.vm.Dispatch(1); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "discarded", "discarded", "discarded", "3")
+
+	// The results of count, handle and i + 1 are popped, and println has none
+	pops := 0
+	for _, ins := range script.vm.binary.Code {
+		if ins.Opcode == op_pop {
+			pops++
+		}
+	}
+
+	if pops != 3 {
+		t.Fatalf("the binary has %d POPs, expected 3", pops)
+	}
+}
+
+func TestSuspendAndResume(t *testing.T) {
+	script := loadScript(t, `
+func wait(int ticks) {
+	println(ticks);
+	sleep(ticks);
+}
+
+on number_typed(1) {
+	wait(2);
+	println("woke after 2");
+}
+
+on number_typed(2) {
+	wait(1);
+	println("woke after 1");
+}
+`)
+
+	scheduler := NewScheduler()
+	for _, number := range []int32{1, 2} {
+		if err := scheduler.Dispatch(script.vm, 2, number); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script.expectOutput(t, "2", "1")
+
+	for i := 0; i < 2; i++ {
+		if err := scheduler.Tick(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script.expectOutput(t, "2", "1", "woke after 1", "woke after 2")
+	if scheduler.Len() != 0 {
+		t.Fatalf("%d instances still suspended", scheduler.Len())
+	}
+
+	// Without a scheduler, a script that suspends cannot be resumed
+	if err := script.vm.Dispatch(2, int32(1)); err == nil {
+		t.Fatal("expected an error dispatching a suspending script without a scheduler")
+	}
+}
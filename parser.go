@@ -2,7 +2,6 @@ package main
 
 import (
 	"strings"
-	"fmt"
 	"strconv"
 	"math"
 )
@@ -13,8 +12,17 @@ type parser struct {
 	source string
 	tokens []token
 	pos    int
+
+	diagnostics []Diagnostic
 }
 
+// parseBailout is used to unwind the parser to the statement containing a syntax error, once it has been reported.
+type parseBailout struct{}
+
+// topLevelBailout unwinds the parser to the next top-level declaration, when a syntax error leaves no statement to
+// resume parsing at.
+type topLevelBailout struct{}
+
 func (p *parser) peek(ahead int) token {
 	if p.pos+ahead >= len(p.tokens) {
 		return eofToken
@@ -39,51 +47,49 @@ func (p *parser) rewind() {
 	}
 }
 
-func (p *parser) unexpected(t token, expected ...string) {
-	panic(fmt.Sprintf("unexpected '%s' (%d), expected one of: %s\n\n%s", t.value, t.tokenType, strings.Join(expected, ", "), p.generateErrorIndicator(t)))
+// fail reports a syntax error at the given token and stops parsing.
+func (p *parser) fail(t token, code DiagnosticCode, format string, args ...interface{}) {
+	p.diagnostics = append(p.diagnostics, newError(code, Span{t.from, t.to}, format, args...))
+	panic(parseBailout{})
 }
 
-func (p *parser) generateErrorIndicator(t token) string {
-	sourcelen := len(p.source)
-	lineStart := 0
-	lineEnd := sourcelen
-	lineNumber := 1
+func (p *parser) unexpected(t token, expected ...string) {
+	p.fail(t, ErrUnexpectedToken, "unexpected %s, expected one of: %s", describeToken(t), strings.Join(expected, ", "))
+}
 
-	// Find line start..
-	for i := 0; i < sourcelen && i < t.from; i++ {
-		if p.source[i] == '\n' && i != sourcelen-1 {
-			lineStart = i + 1
-			lineNumber++
-		}
+func (p *parser) unexpect(t tokenType, name string, expected ...string) {
+	if p.peek(0).tokenType == t {
+		p.fail(p.peek(0), ErrUnexpectedToken, "unexpected %s, expected one of: %s", name, strings.Join(expected, ", "))
 	}
+}
 
-	// Find line end..
-	for i := lineStart + 1; i < sourcelen; i++ {
-		if p.source[i] == '\n' {
-			lineEnd = i - 1
-			break
-		}
+func (p *parser) expect(t tokenType, name string) {
+	if p.peek(0).tokenType != t {
+		p.fail(p.peek(0), ErrUnexpectedToken, "unexpected %s, expected %s", describeToken(p.peek(0)), name)
 	}
+}
 
-	// Create ^^-indicator..
-	col := t.from - lineStart
-	lineNumberStr := strconv.Itoa(lineNumber) + ": "
-	indicator := strings.Repeat(" ", len(lineNumberStr)+col) + strings.Repeat("^", t.to-t.from)
+func describeToken(t token) string {
+	if t.tokenType == tokenEOF {
+		return "end of file"
+	}
 
-	return fmt.Sprintf("%s%s\n%s", lineNumberStr, p.source[lineStart:lineEnd], indicator)
+	return "'" + t.value + "'"
 }
 
-func (p *parser) unexpect(t tokenType, name string, expected ...string) {
-	if p.peek(0).tokenType == t {
-		panic(fmt.Sprintf("unexpected %s, expected one of: %s\n\n%s", name, strings.Join(expected, ", "), p.generateErrorIndicator(p.peek(0))))
+// spanFrom returns the span from the start of the given token up to the end of the last consumed token.
+func (p *parser) spanFrom(start token) Span {
+	end := start.to
+	if p.pos > 0 && p.pos <= len(p.tokens) && p.tokens[p.pos-1].to > end {
+		end = p.tokens[p.pos-1].to
 	}
+
+	return Span{start.from, end}
 }
 
-func (p *parser) expect(t tokenType, name string) {
-	if p.peek(0).tokenType != t {
-		panic(fmt.Sprintf("unexpected %s, expected %s\n\n%s", p.peek(0).value, name, p.generateErrorIndicator(p.peek(0))))
-		panic("unexpected '" + p.peek(0).value + "', expected '" + name + "'")
-	}
+// spanOf returns the span covering both nodes, used for binary expressions.
+func spanOf(left ASTNode, right ASTNode) Span {
+	return Span{left.Position().From, right.Position().To}
 }
 
 func (p *parser) expectConsume(t tokenType, name string) token {
@@ -99,29 +105,135 @@ func (p *parser) parseTopLevelDecl() ASTNode {
 	} else if t.tokenType == tokenFunc {
 		p.rewind()
 		return p.parseFunc()
+	} else if t.tokenType == tokenConst {
+		p.rewind()
+		return p.parseConst()
+	} else if t.tokenType == tokenPersist || t.tokenType == tokenIdentifier {
+		p.rewind()
+		return p.parseGlobal()
 	} else {
-		p.unexpected(t, "on", "func")
+		p.unexpected(t, "on", "func", "const", "persist", "variable type")
 	}
 
 	return nil
 }
 
 func (p *parser) parseTrigger() ASTNode {
-	p.expectConsume(tokenOn, "on")
+	start := p.expectConsume(tokenOn, "on")
 	identifier := p.expectConsume(tokenIdentifier, "identifier")
 	p.expectConsume(tokenLParen, "(")
-	value := p.expectConsume(tokenInteger, "integer")
+
+	// One entry per listener parameter: filter values, each with optional alternatives, followed by parameters bound
+	// to locals. For example: on name(1 | 2, "obj_*", int number)
+	var filters [][]ASTNode
+	var bound []FuncArgument
+	for p.peek(0).tokenType != tokenRParen {
+		if len(filters)+len(bound) > 0 {
+			p.expectConsume(tokenComma, "','")
+		}
+
+		// A type followed by a name binds the parameter, anything else is a filter value
+		if next := p.peek(1).tokenType; p.peek(0).tokenType == tokenIdentifier && (next == tokenIdentifier || next == tokenLessThan) {
+			bound = append(bound, p.parseParameter())
+			continue
+		}
+
+		if len(bound) > 0 {
+			p.fail(p.peek(0), ErrUnexpectedToken, "filter values must come before bound parameters")
+		}
+
+		alternatives := []ASTNode{p.parseFilterValue()}
+		for p.peek(0).tokenType == tokenPipe {
+			p.next()
+			alternatives = append(alternatives, p.parseFilterValue())
+		}
+
+		filters = append(filters, alternatives)
+	}
 	p.expectConsume(tokenRParen, ")")
+
+	// The arguments delivered with the event can be bound in a second parameter list: on name(...)(gameobj door)
+	var arguments []FuncArgument
+	if p.peek(0).tokenType == tokenLParen {
+		p.next()
+		arguments = p.parseParameterList()
+	}
+
 	stmt := p.parseStatement()
-	return newTrigger(identifier.value, value.value, stmt)
+	return newTrigger(p.spanFrom(start), identifier.value, filters, bound, arguments, stmt)
+}
+
+// parseFilterValue parses a single trigger filter value, which has to be a literal.
+func (p *parser) parseFilterValue() ASTNode {
+	return p.parseConstantValue("trigger filter values")
+}
+
+// parseConstantValue parses a value that has to be known at compile time: a literal, or the name of a constant.
+func (p *parser) parseConstantValue(what string) ASTNode {
+	start := p.peek(0)
+	value := p.parseUnary()
+	switch value.(type) {
+	case *ASTLiteralExpr, *ASTIdentifierExpr:
+	default:
+		p.fail(start, ErrUnexpectedToken, "%s must be literals or constants", what)
+	}
+
+	return value
+}
+
+// parseGlobal parses a top-level variable declaration. Globals are set up before any script runs, so their initial
+// value has to be known at compile time.
+func (p *parser) parseGlobal() ASTNode {
+	start := p.peek(0)
+	persist := false
+	if start.tokenType == tokenPersist {
+		p.next()
+		persist = true
+	}
+
+	_, varType := p.parseType("variable type")
+	name := p.expectConsume(tokenIdentifier, "variable name")
+
+	var value ASTNode
+	if p.peek(0).tokenType == tokenAssign {
+		p.next()
+		value = p.parseConstantValue("initial values of globals")
+	}
+
+	p.expectConsume(tokenSemicolon, "';'")
+	return newGlobalDecl(p.spanFrom(start), varType, name.value, value, persist)
+}
+
+func (p *parser) parseConst() ASTNode {
+	start := p.expectConsume(tokenConst, "const")
+	_, varType := p.parseType("constant type")
+	name := p.expectConsume(tokenIdentifier, "constant name")
+	p.expectConsume(tokenAssign, "'='")
+	value := p.parseConstantValue("constant values")
+	p.expectConsume(tokenSemicolon, "';'")
+
+	return newConstDecl(p.spanFrom(start), varType, name.value, value)
 }
 
 func (p *parser) parseFunc() ASTNode {
-	p.expectConsume(tokenFunc, "func")
+	start := p.expectConsume(tokenFunc, "func")
+
+	// The return type is optional: 'func name()' is the same as 'func void name()'
+	returnType := "void"
+	if p.peek(1).tokenType == tokenIdentifier || p.peek(1).tokenType == tokenLessThan {
+		_, returnType = p.parseType("return type")
+	}
+
 	name := p.expectConsume(tokenIdentifier, "function name")
 	p.expectConsume(tokenLParen, "'('")
+	arguments := p.parseParameterList()
+
+	body := p.parseStatement()
+	return newFunc(p.spanFrom(start), name.value, returnType, body, arguments...)
+}
 
-	// Parse argument list..
+// parseParameterList parses typed parameters up to and including the closing ')'.
+func (p *parser) parseParameterList() []FuncArgument {
 	arguments := []FuncArgument{}
 	needsComma := false
 	for {
@@ -136,49 +248,137 @@ func (p *parser) parseFunc() ASTNode {
 				p.unexpect(tokenComma, "','")
 			}
 		} else {
-			argType := p.expectConsume(tokenIdentifier, "argument type")
-			argName := p.expectConsume(tokenIdentifier, "argument name")
-
-			arguments = append(arguments, FuncArgument{argName.value, argType.value})
+			arguments = append(arguments, p.parseParameter())
 			needsComma = true
 		}
 	}
 
-	p.expectConsume(tokenRParen, "')")
-	body := p.parseStatement()
-	return newFunc(name.value, body, arguments...)
+	p.expectConsume(tokenRParen, "')'")
+	return arguments
+}
+
+func (p *parser) parseParameter() FuncArgument {
+	argStart, argType := p.parseType("argument type")
+	argName := p.expectConsume(tokenIdentifier, "argument name")
+
+	return FuncArgument{argName.value, argType, p.spanFrom(argStart)}
 }
 
-func (p *parser) parseStatement() ASTNode {
+// parseStatement parses a single statement. A statement containing a syntax error is skipped, and nil is returned so
+// the surrounding code can continue with the next statement.
+func (p *parser) parseStatement() (node ASTNode) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(parseBailout); !ok {
+				panic(r)
+			}
+
+			node = nil
+			p.synchronizeStatement()
+		}
+	}()
+
 	switch p.peek(0).tokenType {
 	case tokenIdentifier:
-		peek := p.peek(1)
-		if peek.tokenType == tokenLParen {
-			return p.parseMethodCall()
-		} else if peek.tokenType == tokenAssign {
+		if p.peek(1).tokenType == tokenAssign {
 			return p.parseVarAssign()
-		} else {
+		} else if p.isVarDecl() {
 			return p.parseVarDecl()
 		}
+
+		statement := p.parseSimpleStatement()
+		p.expectConsume(tokenSemicolon, "';'")
+		return statement
+	case tokenInteger, tokenFloat, tokenString, tokenStringStart, tokenBool, tokenLParen, tokenNot, tokenMinus:
+		statement := p.parseSimpleStatement()
+		p.expectConsume(tokenSemicolon, "';'")
+		return statement
 	case tokenLBrack:
 		return p.parseBlockStatement()
 	case tokenIf:
 		return p.parseIfStmt()
+	case tokenWhile:
+		return p.parseWhileStmt()
+	case tokenFor:
+		return p.parseForStmt()
+	case tokenBreak:
+		start := p.next()
+		p.expectConsume(tokenSemicolon, "';'")
+		return newBreakStmt(p.spanFrom(start))
+	case tokenContinue:
+		start := p.next()
+		p.expectConsume(tokenSemicolon, "';'")
+		return newContinueStmt(p.spanFrom(start))
+	case tokenReturn:
+		start := p.next()
+		var value ASTNode
+		if p.peek(0).tokenType != tokenSemicolon {
+			value = p.parseExpression()
+		}
+		p.expectConsume(tokenSemicolon, "';'")
+		return newReturnStmt(p.spanFrom(start), value)
 	default:
-		p.unexpected(p.peek(0), "method call", "variable declaration")
+		p.unexpected(p.peek(0), "expression", "variable declaration")
 	}
 
 	return nil
 }
 
-func (p *parser) parseMethodCall() ASTNode {
-	method := p.parseMethodExpr()
-	p.expectConsume(tokenSemicolon, "';'")
-	return method
+// isVarDecl tells whether the statement starting at the current identifier declares a variable: a type, such as int or
+// native<Player>, followed by the name of the variable.
+func (p *parser) isVarDecl() bool {
+	if p.peek(1).tokenType == tokenIdentifier {
+		return true
+	}
+
+	return p.peek(1).tokenType == tokenLessThan && p.peek(2).tokenType == tokenIdentifier &&
+		p.peek(3).tokenType == tokenGreaterThan && p.peek(4).tokenType == tokenIdentifier
+}
+
+// parseSimpleStatement parses an assignment, a field assignment or an expression whose result is discarded, without
+// the terminating ';'.
+func (p *parser) parseSimpleStatement() ASTNode {
+	if p.peek(0).tokenType == tokenIdentifier && p.peek(1).tokenType == tokenAssign {
+		return p.parseAssignment()
+	}
+
+	start := p.peek(0)
+	expr := p.parseExpression()
+
+	if target, ok := expr.(*ASTFieldExpr); ok && p.peek(0).tokenType == tokenAssign {
+		p.next()
+		value := p.parseExpression()
+		return newFieldAssign(p.spanFrom(start), target, value)
+	}
+
+	return newStmt(p.spanFrom(start), expr)
 }
 
 func (p *parser) parseMethodExpr() ASTNode {
 	identifier := p.expectConsume(tokenIdentifier, "method identifier")
+	arguments := p.parseArguments()
+	return newMethodExpr(p.spanFrom(identifier), identifier.value, arguments...)
+}
+
+// parsePostfix parses member accesses following an expression: fields (a.b) and method calls (a.b(c)).
+func (p *parser) parsePostfix(left ASTNode) ASTNode {
+	for p.peek(0).tokenType == tokenDot {
+		p.next()
+		name := p.expectConsume(tokenIdentifier, "member name")
+
+		if p.peek(0).tokenType == tokenLParen {
+			arguments := p.parseArguments()
+			left = newInvokeExpr(Span{left.Position().From, p.spanFrom(name).To}, left, name.value, arguments...)
+		} else {
+			left = newFieldExpr(Span{left.Position().From, name.to}, left, name.value)
+		}
+	}
+
+	return left
+}
+
+// parseArguments parses a parenthesized, comma separated list of expressions.
+func (p *parser) parseArguments() []ASTNode {
 	p.expectConsume(tokenLParen, "(")
 
 	arguments := []ASTNode{}
@@ -204,11 +404,11 @@ func (p *parser) parseMethodExpr() ASTNode {
 	}
 
 	p.expectConsume(tokenRParen, ")")
-	return newMethodExpr(identifier.value, arguments...)
+	return arguments
 }
 
 func (p *parser) parseIfStmt() ASTNode {
-	p.expectConsume(tokenIf, "if")
+	start := p.expectConsume(tokenIf, "if")
 	p.expectConsume(tokenLParen, "'('")
 	condition := p.parseExpression()
 	p.expectConsume(tokenRParen, "')'")
@@ -222,11 +422,66 @@ func (p *parser) parseIfStmt() ASTNode {
 		ifFalse = p.parseStatement()
 	}
 
-	return newIfStmt(condition, ifTrue, ifFalse)
+	return newIfStmt(p.spanFrom(start), condition, ifTrue, ifFalse)
+}
+
+func (p *parser) parseWhileStmt() ASTNode {
+	start := p.expectConsume(tokenWhile, "while")
+	p.expectConsume(tokenLParen, "'('")
+	condition := p.parseExpression()
+	p.expectConsume(tokenRParen, "')'")
+
+	body := p.parseStatement()
+	return newWhileStmt(p.spanFrom(start), condition, body)
+}
+
+func (p *parser) parseForStmt() ASTNode {
+	start := p.expectConsume(tokenFor, "for")
+	p.expectConsume(tokenLParen, "'('")
+
+	// Initializer: a variable declaration or assignment, both of which consume the ';'
+	var init ASTNode
+	if p.peek(0).tokenType == tokenSemicolon {
+		p.next()
+	} else if p.peek(1).tokenType == tokenAssign {
+		init = p.parseVarAssign()
+	} else {
+		init = p.parseVarDecl()
+	}
+
+	var condition ASTNode
+	if p.peek(0).tokenType != tokenSemicolon {
+		condition = p.parseExpression()
+	}
+	p.expectConsume(tokenSemicolon, "';'")
+
+	// Post statement: an assignment or expression, without a terminating ';'
+	var post ASTNode
+	if p.peek(0).tokenType != tokenRParen {
+		post = p.parseSimpleStatement()
+	}
+	p.expectConsume(tokenRParen, "')'")
+
+	body := p.parseStatement()
+	return newForStmt(p.spanFrom(start), init, condition, post, body)
+}
+
+// parseType parses a type name, such as int or native<Player>. It returns the first token of the type and its name.
+func (p *parser) parseType(name string) (token, string) {
+	start := p.expectConsume(tokenIdentifier, name)
+	if p.peek(0).tokenType != tokenLessThan {
+		return start, start.value
+	}
+
+	p.next()
+	inner := p.expectConsume(tokenIdentifier, "type name")
+	p.expectConsume(tokenGreaterThan, "'>'")
+
+	return start, start.value + "<" + inner.value + ">"
 }
 
 func (p *parser) parseVarDecl() ASTNode {
-	varType := p.expectConsume(tokenIdentifier, "variable type")
+	varStart, varType := p.parseType("variable type")
 	varName := p.expectConsume(tokenIdentifier, "variable name")
 
 	var varValue ASTNode
@@ -236,20 +491,26 @@ func (p *parser) parseVarDecl() ASTNode {
 	}
 
 	p.expectConsume(tokenSemicolon, "';'")
-	return newAssignment(varType.value, varName.value, varValue)
+	return newAssignment(p.spanFrom(varStart), varType, varName.value, varValue)
 }
 
 func (p *parser) parseVarAssign() ASTNode {
+	assignment := p.parseAssignment()
+	p.expectConsume(tokenSemicolon, "';'")
+	return assignment
+}
+
+// parseAssignment parses an assignment without the terminating ';', as used in the post statement of a for loop.
+func (p *parser) parseAssignment() ASTNode {
 	varName := p.expectConsume(tokenIdentifier, "variable name")
 	p.expectConsume(tokenAssign, "'='")
 	varValue := p.parseExpression()
-	p.expectConsume(tokenSemicolon, "';'")
 
-	return newVarAssign(varName.value, varValue)
+	return newVarAssign(p.spanFrom(varName), varName.value, varValue)
 }
 
 func (p *parser) parseBlockStatement() ASTNode {
-	p.expectConsume(tokenLBrack, "'{'")
+	start := p.expectConsume(tokenLBrack, "'{'")
 
 	statements := []ASTNode{}
 	for {
@@ -258,23 +519,37 @@ func (p *parser) parseBlockStatement() ASTNode {
 			break
 		}
 
-		statements = append(statements, p.parseStatement())
+		if statement := p.parseStatement(); statement != nil {
+			statements = append(statements, statement)
+		}
 	}
 
 	p.expectConsume(tokenRBrack, "'}'")
-	return newBlock(statements...)
+	return newBlock(p.spanFrom(start), statements...)
 }
 
 func (p *parser) parseExpression() ASTNode {
 	return p.parseLogicalExpression()
 }
 
+// parseLogicalExpression parses ||, which binds weaker than &&.
 func (p *parser) parseLogicalExpression() ASTNode {
+	left := p.parseLogicalAnd()
+	for p.peek(0).tokenType == tokenOr {
+		operator := p.next()
+		right := p.parseLogicalAnd()
+		left = newLogicalExpr(spanOf(left, right), left, operator.tokenType, right)
+	}
+
+	return left
+}
+
+func (p *parser) parseLogicalAnd() ASTNode {
 	left := p.parseEquality()
-	for isLogicalOperator(p.peek(0).tokenType) {
+	for p.peek(0).tokenType == tokenAnd {
 		operator := p.next()
 		right := p.parseEquality()
-		left = newLogicalExpr(left, operator.tokenType, right)
+		left = newLogicalExpr(spanOf(left, right), left, operator.tokenType, right)
 	}
 
 	return left
@@ -285,7 +560,7 @@ func (p *parser) parseEquality() ASTNode {
 	for isEqualityOperator(p.peek(0).tokenType) {
 		operator := p.next()
 		right := p.parseRelational()
-		left = newLogicalExpr(left, operator.tokenType, right)
+		left = newLogicalExpr(spanOf(left, right), left, operator.tokenType, right)
 	}
 
 	return left
@@ -296,7 +571,7 @@ func (p *parser) parseRelational() ASTNode {
 	for isRelationalOperator(p.peek(0).tokenType) {
 		operator := p.next()
 		right := p.parseAddSubtract()
-		left = newLogicalExpr(left, operator.tokenType, right)
+		left = newLogicalExpr(spanOf(left, right), left, operator.tokenType, right)
 	}
 
 	return left
@@ -308,26 +583,60 @@ func (p *parser) parseAddSubtract() ASTNode {
 	for isAddOrSubtract(p.peek(0).tokenType) {
 		operator := p.next()
 		right := p.parseMulDivide()
-		left = newLogicalExpr(left, operator.tokenType, right)
+		left = newLogicalExpr(spanOf(left, right), left, operator.tokenType, right)
 	}
 
 	return left
 }
 
 func (p *parser) parseMulDivide() ASTNode {
-	left := p.parseTerminalExpression()
+	left := p.parseUnary()
 
 	for isMultiplyOrDivide(p.peek(0).tokenType) {
 		operator := p.next()
-		right := p.parseTerminalExpression()
-		left = newLogicalExpr(left, operator.tokenType, right)
+		right := p.parseUnary()
+		left = newLogicalExpr(spanOf(left, right), left, operator.tokenType, right)
 	}
 
 	return left
 }
 
+func (p *parser) parseUnary() ASTNode {
+	peek := p.peek(0)
+	if peek.tokenType == tokenLParen && isCastType(p.peek(1)) && p.peek(2).tokenType == tokenRParen {
+		p.next()
+		typeName := p.next()
+		p.next()
+
+		operand := p.parseUnary()
+		return newCastExpr(p.spanFrom(peek), typeName.value, operand)
+	}
+
+	if peek.tokenType != tokenNot && peek.tokenType != tokenMinus {
+		return p.parsePostfix(p.parseTerminalExpression())
+	}
+
+	operator := p.next()
+
+	// Fold negative integer literals, so the smallest int is not parsed as a long, and negative floats along with them
+	if operator.tokenType == tokenMinus && p.peek(0).tokenType == tokenInteger {
+		return p.parseIntegerLiteral(operator, "-"+p.next().value)
+	} else if operator.tokenType == tokenMinus && p.peek(0).tokenType == tokenFloat {
+		return p.parseFloatLiteral(operator, "-"+p.next().value)
+	}
+
+	operand := p.parseUnary()
+	return newUnaryExpr(p.spanFrom(operator), operator.tokenType, operand)
+}
+
+// isCastType checks whether the token names a type that can be cast to. Only numbers can be cast, so a parenthesized
+// variable is never mistaken for a cast.
+func isCastType(t token) bool {
+	return t.tokenType == tokenIdentifier && (t.value == "int" || t.value == "long" || t.value == "float")
+}
+
 func isLogicalOperator(t tokenType) bool {
-	return false
+	return t == tokenAnd || t == tokenOr
 }
 
 func isEqualityOperator(t tokenType) bool {
@@ -343,7 +652,7 @@ func isAddOrSubtract(t tokenType) bool {
 }
 
 func isMultiplyOrDivide(t tokenType) bool {
-	return t == tokenMultiply || t == tokenDivide
+	return t == tokenMultiply || t == tokenDivide || t == tokenModulo
 }
 
 func (p *parser) parseTerminalExpression() ASTNode {
@@ -351,27 +660,24 @@ func (p *parser) parseTerminalExpression() ASTNode {
 	switch peek.tokenType {
 	case tokenInteger:
 		tok := p.next()
-		v, e := strconv.ParseInt(tok.value, 10, 64)
-		if e != nil {
-			panic("error parsing int value from string: " + tok.value)
-		}
-
-		if v > math.MaxInt32 || v < math.MinInt32 {
-			return newLiteral(LiteralLong, int64(v))
-		} else {
-			return newLiteral(LiteralInteger, int(v))
-		}
+		return p.parseIntegerLiteral(tok, tok.value)
+	case tokenFloat:
+		tok := p.next()
+		return p.parseFloatLiteral(tok, tok.value)
 	case tokenString:
-		v, _ := strconv.Unquote(p.next().value)
-		return newLiteral(LiteralString, v)
+		tok := p.next()
+		return newLiteral(p.spanFrom(tok), LiteralString, stringValue(tok.value))
+	case tokenStringStart:
+		return p.parseInterpolation()
 	case tokenBool:
-		value := p.next().value == "true"
-		return newLiteral(LiteralBoolean, value)
+		tok := p.next()
+		return newLiteral(p.spanFrom(tok), LiteralBoolean, tok.value == "true")
 	case tokenIdentifier:
 		if p.peek(1).tokenType == tokenLParen {
 			return p.parseMethodExpr()
 		} else {
-			return newIdentifier(p.next().value)
+			tok := p.next()
+			return newIdentifier(p.spanFrom(tok), tok.value)
 		}
 	case tokenLParen: // Parenthesized expression
 		p.expectConsume(tokenLParen, "'('")
@@ -385,6 +691,73 @@ func (p *parser) parseTerminalExpression() ASTNode {
 	return nil
 }
 
+// parseInterpolation parses a string literal containing ${expression} parts. It is compiled the same way as the
+// concatenation of its text and expressions with +, so "Hello ${name}!" is the same as "Hello " + name + "!".
+func (p *parser) parseInterpolation() ASTNode {
+	start := p.next()
+	var result ASTNode = newLiteral(p.spanFrom(start), LiteralString, unescape(strings.TrimSuffix(start.value[1:], "${")))
+
+	for {
+		expr := p.parseExpression()
+		result = newLogicalExpr(spanOf(result, expr), result, tokenPlus, expr)
+
+		part := p.next()
+		if part.tokenType != tokenStringMiddle && part.tokenType != tokenStringEnd {
+			p.unexpected(part, "'}'")
+		}
+
+		// The part starts with the closing brace, and ends with either the quote or the next ${
+		text := strings.TrimSuffix(strings.TrimSuffix(part.value[1:], "${"), "\"")
+
+		if text != "" {
+			literal := newLiteral(Span{part.from, part.to}, LiteralString, unescape(text))
+			result = newLogicalExpr(spanOf(result, literal), result, tokenPlus, literal)
+		}
+
+		if part.tokenType == tokenStringEnd {
+			return result
+		}
+	}
+}
+
+// stringValue returns the value of a string literal token. The closing quote is missing if the literal is unterminated,
+// which the scanner has reported already.
+func stringValue(literal string) string {
+	if strings.HasPrefix(literal, "`") {
+		// Carriage returns are left out of raw strings, so that their value does not depend on the line endings of the
+		// file
+		text := strings.TrimSuffix(literal[1:], "`")
+		return strings.Replace(text, "\r", "", -1)
+	}
+
+	return unescape(strings.TrimSuffix(literal[1:], "\""))
+}
+
+// parseIntegerLiteral creates an int literal, or a long literal if the value does not fit an int. The literal starts at
+// the given token; text is the literal including its sign.
+func (p *parser) parseIntegerLiteral(start token, text string) ASTNode {
+	v, e := strconv.ParseInt(text, 10, 64)
+	if e != nil {
+		p.fail(start, ErrInvalidLiteral, "invalid integer literal %s", text)
+	}
+
+	if v > math.MaxInt32 || v < math.MinInt32 {
+		return newLiteral(p.spanFrom(start), LiteralLong, int64(v))
+	} else {
+		return newLiteral(p.spanFrom(start), LiteralInteger, int(v))
+	}
+}
+
+// parseFloatLiteral creates a float literal starting at the given token; text is the literal including its sign.
+func (p *parser) parseFloatLiteral(start token, text string) ASTNode {
+	v, e := strconv.ParseFloat(text, 64)
+	if e != nil {
+		p.fail(start, ErrInvalidLiteral, "invalid float literal %s", text)
+	}
+
+	return newLiteral(p.spanFrom(start), LiteralFloat, v)
+}
+
 func (p *parser) run() []ASTNode {
 	nodes := []ASTNode{}
 
@@ -394,18 +767,117 @@ func (p *parser) run() []ASTNode {
 			break
 		}
 
-		node := p.parseTopLevelDecl()
-		nodes = append(nodes, node)
+		if node := p.parseTopLevel(); node != nil {
+			nodes = append(nodes, node)
+		}
 	}
 
 	return nodes
 }
 
-func Parse(source string, tokens []token) []ASTNode {
+// parseTopLevel parses a single top-level declaration. If it contains a syntax error that could not be recovered from
+// within the declaration, the rest of it is skipped and nil is returned.
+func (p *parser) parseTopLevel() (node ASTNode) {
+	start := p.pos
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch r.(type) {
+			case parseBailout, topLevelBailout:
+			default:
+				panic(r)
+			}
+
+			node = nil
+			p.synchronizeTopLevel(start)
+		}
+	}()
+
+	return p.parseTopLevelDecl()
+}
+
+// synchronizeStatement skips the remainder of a statement containing a syntax error, up to and including its ';'.
+// Blocks opened within the statement are skipped as a whole, and a '}' closing the enclosing block is left for the
+// block to consume. Reaching the next top-level declaration unwinds to the top level.
+func (p *parser) synchronizeStatement() {
+	depth := 0
+
+	for {
+		switch p.peek(0).tokenType {
+		case tokenEOF, tokenOn, tokenFunc, tokenConst, tokenPersist:
+			panic(topLevelBailout{})
+		case tokenSemicolon:
+			p.next()
+			if depth == 0 {
+				return
+			}
+		case tokenLBrack:
+			p.next()
+			depth++
+		case tokenRBrack:
+			if depth == 0 {
+				return
+			}
+
+			p.next()
+			depth--
+			if depth == 0 {
+				return
+			}
+		default:
+			p.next()
+		}
+	}
+}
+
+// synchronizeTopLevel skips tokens up to the start of the next top-level declaration. Besides a keyword starting one,
+// that is after a ';' or a block ending at the top level, or at a type followed by a name, which starts a global.
+func (p *parser) synchronizeTopLevel(start int) {
+	// Always make progress, even if the declaration failed at its very first token
+	if p.pos == start {
+		p.next()
+	}
+
+	depth := 0
+
+	for {
+		switch p.peek(0).tokenType {
+		case tokenEOF, tokenOn, tokenFunc, tokenConst, tokenPersist:
+			return
+		case tokenIdentifier:
+			if depth == 0 && p.isVarDecl() {
+				return
+			}
+			p.next()
+		case tokenSemicolon:
+			p.next()
+			if depth == 0 {
+				return
+			}
+		case tokenLBrack:
+			p.next()
+			depth++
+		case tokenRBrack:
+			p.next()
+			if depth <= 1 {
+				return
+			}
+			depth--
+		default:
+			p.next()
+		}
+	}
+}
+
+// Parse builds the syntax tree of a source file. The parser recovers from syntax errors at statement and declaration
+// boundaries, so every syntax error in the file is returned as a diagnostic. Declarations and statements containing
+// errors are left out of the returned tree.
+func Parse(source string, tokens []token) ([]ASTNode, []Diagnostic) {
 	p := parser{
 		tokens: tokens,
 		source: source,
 	}
 
-	return p.run()
+	nodes := p.run()
+	return nodes, p.diagnostics
 }
@@ -0,0 +1,98 @@
+package main
+
+import "testing"
+
+func TestParserRecovery(t *testing.T) {
+	diagnostics := compileErrors(t, `
+func broken(int value { println("a"); }
+
+on number_typed(1) {
+	println("count" + );
+	int y = 1
+	println(y);
+}
+
+func other(int a, b) {
+	println(a);
+}
+}
+
+on number_typed(2) {
+	int x = = 2;
+}
+`)
+
+	// Every syntax error is reported on its own line
+	var lines []int
+	for _, d := range diagnostics {
+		if d.Code != ErrUnexpectedToken {
+			t.Errorf("unexpected diagnostic after recovering: %s", d.Error())
+		}
+		lines = append(lines, d.Line)
+	}
+
+	expected := []int{2, 5, 7, 10, 13, 16}
+	if len(lines) != len(expected) {
+		t.Fatalf("errors reported on lines %v, expected %v", lines, expected)
+	}
+
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Fatalf("errors reported on lines %v, expected %v", lines, expected)
+		}
+	}
+}
+
+func TestParserRecoveryGlobals(t *testing.T) {
+	diagnostics := compileErrors(t, `
+const int LIMIT = ;
+int count = 0;
+
+func int broken( { return 1; }
+int other = 2;
+string name = "a" "b";
+bool flag = true;
+
+on number_typed(int number) {
+	other = number + count;
+	flag = !flag;
+}
+`)
+
+	// The globals after the syntax errors are still declared, so using them is not an error
+	var lines []int
+	for _, d := range diagnostics {
+		if d.Code != ErrUnexpectedToken {
+			t.Errorf("unexpected diagnostic after recovering: %s", d.Error())
+		}
+		lines = append(lines, d.Line)
+	}
+
+	expected := []int{2, 5, 7}
+	if len(lines) != len(expected) {
+		t.Fatalf("errors reported on lines %v, expected %v", lines, expected)
+	}
+
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Fatalf("errors reported on lines %v, expected %v", lines, expected)
+		}
+	}
+}
+
+func TestParseEndOfText(t *testing.T) {
+	for _, source := range []string{
+		"int x",
+		"on number_typed(1) { x",
+		"on number_typed(1) { int value",
+		"func check(int value",
+		"on number_typed(1) { println(1); // comment",
+		"on number_typed(1) { println(1); /* unterminated",
+		"on number_typed(1) /* unterminated",
+	} {
+		diagnostics := compileErrors(t, source)
+		if diagnostics[0].Code != ErrUnexpectedToken {
+			t.Errorf("expected %s for %q, got %v", ErrUnexpectedToken, source, diagnostics)
+		}
+	}
+}
@@ -4,19 +4,137 @@ import (
 	"fmt"
 	"text/tabwriter"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 func (a *Assembler) PrettyPrint() {
-	fmt.Println("")
+	printListing(a.program.methods, a.binaryGlobals(), a.cpool.values, a.program.runtime)
+}
+
+// PrettyPrint prints the same listing as Assembler.PrettyPrint, reconstructed from the binary alone. Method and
+// variable names are taken from the debug section; without one, generated names are used instead. The runtime is
+// optional; when given, native calls and triggers are printed with their names.
+func (b *Binary) PrettyPrint(runtime *AdderRuntime) {
+	printListing(b.listingMethods(runtime), b.Globals, b.Constants, runtime)
+}
+
+// listingMethods splits the instruction stream back into methods, and reinserts the labels for method entries and
+// jump targets that the assembler had.
+func (b *Binary) listingMethods(runtime *AdderRuntime) []*Method {
+	entries := make([]int, len(b.Methods))
+	for i, v := range b.Methods {
+		entries[i] = v.Entry
+	}
+	sort.Ints(entries)
+
+	var methods []*Method
+	for index, bm := range b.Methods {
+		method := &Method{name: fmt.Sprintf("func_%d", bm.Index), index: bm.Index, lvtIndex: bm.Locals, maxStack: bm.MaxStack}
+
+		for i, trigger := range b.Triggers {
+			if trigger.Address == bm.Entry {
+				method.name = triggerMethodName(runtime, trigger, i)
+			}
+		}
+
+		var debug *DebugMethod
+		if b.Debug != nil && index < len(b.Debug.Methods) {
+			debug = b.Debug.Methods[index]
+			method.name = debug.Name
+		}
+
+		// The method ends where the next one begins
+		end := len(b.Code)
+		for _, entry := range entries {
+			if entry > bm.Entry && entry < end {
+				end = entry
+			}
+		}
+
+		start := bm.Entry
+		if start < 0 || start > end {
+			start = end
+		}
+
+		labels := map[int]bool{start: true}
+		for _, ins := range b.Code[start:end] {
+			if ins.Opcode == op_jmp || ins.Opcode == op_jz {
+				labels[ins.cpoolIndex] = true
+			}
+		}
+
+		for address := start; address <= end; address++ {
+			if labels[address] {
+				method.instructions = append(method.instructions, &Instruction{Opcode: op_label, address: address})
+			}
+
+			if address < end {
+				method.instructions = append(method.instructions, b.Code[address])
+			}
+		}
+
+		for i := 0; i < bm.Locals; i++ {
+			local := &LocalVariable{index: i, name: "local_" + strconv.Itoa(i)}
+			if i < bm.Arguments {
+				local.name = "arg_" + strconv.Itoa(i)
+				method.arguments = append(method.arguments, local)
+			}
+
+			if debug != nil && i < len(debug.Locals) && debug.Locals[i] != "" {
+				local.name = debug.Locals[i]
+			}
+
+			method.variables = append(method.variables, local)
+		}
+
+		methods = append(methods, method)
+	}
+
+	return methods
+}
+
+func triggerMethodName(runtime *AdderRuntime, trigger *BinaryTrigger, index int) string {
+	name := "listener_" + strconv.Itoa(trigger.ListenerId)
+	if runtime != nil {
+		for _, v := range runtime.Listeners {
+			if v.InternalId == trigger.ListenerId {
+				name = v.Name
+			}
+		}
+	}
+
+	values := make([]string, len(trigger.Values))
+	for i, v := range trigger.Values {
+		values[i] = formatFilterValue(v)
+	}
+
+	return "@" + name + "@" + strings.Join(values, ",") + "@" + strconv.Itoa(index)
+}
+
+func printListing(methods []*Method, globals []*BinaryGlobal, cpool []*ConstantPoolEntry, runtime *AdderRuntime) {
 	fmt.Println("Pretty print output:")
 	fmt.Println("---------------------")
 	fmt.Println("")
 
+	if len(globals) > 0 {
+		fmt.Println("Defined globals:")
+		for i, v := range globals {
+			persist := ""
+			if v.Persist {
+				persist = "persist "
+			}
+
+			fmt.Printf("\t%d: %s%s = %s\n", i, persist, v.Name, formatFilterValue(v.Value))
+		}
+
+		fmt.Println()
+	}
+
 	fmt.Println("Defined methods:")
-	for i, v := range a.program.methods {
-		fmt.Printf("\t%d: %s (%d instructions)\n", i, v.name, len(v.instructions))
+	for i, v := range methods {
+		fmt.Printf("\t%d: %s (%d instructions, %d locals, max stack %d)\n", i, v.name, len(listedInstructions(v)), v.lvtIndex, v.maxStack)
 
 		for ii, vv := range v.variables {
 			fmt.Printf("\t\tArgument %d: %s\n", ii, vv.name)
@@ -25,13 +143,22 @@ func (a *Assembler) PrettyPrint() {
 		fmt.Println()
 	}
 
+	// Every method starts with the label of its entry, which calls refer to
+	entries := map[int]string{}
+	for _, v := range methods {
+		if len(v.instructions) > 0 && v.instructions[0].Opcode == op_label {
+			entries[v.instructions[0].address] = v.name
+		}
+	}
+
 	fmt.Println("Method code:")
 	tw := tabwriter.NewWriter(os.Stdout, 8, 4, 2, '\t', 0)
-	for i, v := range a.program.methods {
-		fmt.Printf("\t%s (id %d with %d instructions)\n", v.name, i, len(v.instructions))
+	for i, v := range methods {
+		instructions := listedInstructions(v)
+		fmt.Printf("\t%s (id %d with %d instructions)\n", v.name, i, len(instructions))
 
-		for _, instr := range v.instructions {
-			printInstruction(tw, a, v, instr)
+		for _, instr := range instructions {
+			printInstruction(tw, globals, cpool, runtime, entries, v, instr)
 		}
 
 		tw.Flush()
@@ -39,13 +166,48 @@ func (a *Assembler) PrettyPrint() {
 	}
 }
 
-func printInstruction(tw *tabwriter.Writer, a *Assembler, m *Method, ins *Instruction) {
+// listedInstructions returns the instructions of a method as they are listed. Only the labels of the method entry and
+// of jump targets are kept, once per address, which are the labels a listing of the binary can reconstruct. The
+// assembler leaves more, such as the unused else label of an if without an else.
+func listedInstructions(m *Method) []*Instruction {
+	if len(m.instructions) == 0 {
+		return nil
+	}
+
+	targets := map[int]bool{m.instructions[0].address: true}
+	for _, ins := range m.instructions {
+		if ins.Opcode == op_jmp || ins.Opcode == op_jz {
+			targets[ins.cpoolIndex] = true
+		}
+	}
+
+	var result []*Instruction
+	for _, ins := range m.instructions {
+		if ins.Opcode == op_label {
+			if !targets[ins.address] {
+				continue
+			}
+
+			// Every following label at this address is a duplicate
+			targets[ins.address] = false
+		}
+
+		result = append(result, ins)
+	}
+
+	return result
+}
+
+func printInstruction(tw *tabwriter.Writer, globals []*BinaryGlobal, cpool []*ConstantPoolEntry, runtime *AdderRuntime, entries map[int]string, m *Method, ins *Instruction) {
 	output := ""
 	op := ins.Opcode
 
 	if op == op_pushconst {
-		val := a.cpool.values[ins.cpoolIndex]
 		desc := "unknown cpool value"
+		val := &ConstantPoolEntry{Type: VarTypeUnresolved}
+		if ins.cpoolIndex >= 0 && ins.cpoolIndex < len(cpool) {
+			val = cpool[ins.cpoolIndex]
+		}
 
 		if val.Type == VarTypeString {
 			desc = "string " + strconv.Quote(val.Value.(string))
@@ -53,17 +215,45 @@ func printInstruction(tw *tabwriter.Writer, a *Assembler, m *Method, ins *Instru
 			desc = "int " + strconv.Itoa(val.Value.(int))
 		} else if val.Type == VarTypeLong {
 			desc = "long " + strconv.FormatInt(val.Value.(int64), 10)
+		} else if val.Type == VarTypeFloat {
+			desc = "float " + formatFloat(val.Value.(float64))
 		}
 
 		output = fmt.Sprintf("PUSHCONST %d\t; %s", ins.cpoolIndex, desc)
+	} else if op == op_nativecall && (runtime == nil || runtime.FindFunctionById(ins.cpoolIndex) == nil) {
+		output = fmt.Sprintf("NATIVECALL %d\t; unknown native function", ins.cpoolIndex)
 	} else if op == op_nativecall {
-		fn := a.program.runtime.FindFunctionById(ins.cpoolIndex)
+		fn := runtime.FindFunctionById(ins.cpoolIndex)
 		args := make([]string, len(fn.Parameters))
 		for i := range args {
 			args[i] = fn.Parameters[i].Type.String() + " " + fn.Parameters[i].Name
 		}
 
 		output = fmt.Sprintf("NATIVECALL %s\t; id %d, %s(%s)", fn.Name, ins.cpoolIndex, fn.Name, strings.Join(args, ", "))
+	} else if op == op_getfield || op == op_setfield {
+		output = fmt.Sprintf("%s %d\t", op.Mnemonic(), ins.cpoolIndex)
+		if runtime != nil {
+			if typ, field := runtime.FindFieldById(ins.cpoolIndex); field != nil {
+				output = fmt.Sprintf("%s %s.%s\t; id %d, %s", op.Mnemonic(), typ.Name, field.Name, ins.cpoolIndex, field.Type.String())
+			}
+		}
+	} else if op == op_invoke {
+		output = fmt.Sprintf("INVOKE %d\t", ins.cpoolIndex)
+		if runtime != nil {
+			if typ, method := runtime.FindMethodById(ins.cpoolIndex); method != nil {
+				output = fmt.Sprintf("INVOKE %s.%s\t; id %d", typ.Name, method.Name, ins.cpoolIndex)
+			}
+		}
+	} else if op == op_getglobal || op == op_setglobal {
+		output = fmt.Sprintf("%s %d\t", op.Mnemonic(), ins.cpoolIndex)
+		if ins.cpoolIndex >= 0 && ins.cpoolIndex < len(globals) {
+			output += "; global " + globals[ins.cpoolIndex].Name
+		}
+	} else if op == op_tostring {
+		output = fmt.Sprintf("TOSTRING %d\t", ins.cpoolIndex)
+		if t, ok := tostringTypes[ins.cpoolIndex]; ok {
+			output += "; " + t.String()
+		}
 	} else if op == op_jmp {
 		output = fmt.Sprintf("JMP %d\t", ins.cpoolIndex)
 	} else if op == op_jz {
@@ -77,12 +267,17 @@ func printInstruction(tw *tabwriter.Writer, a *Assembler, m *Method, ins *Instru
 		}
 	} else if op == op_call {
 		output = fmt.Sprintf("CALL %d\t", ins.cpoolIndex)
+		if name, ok := entries[ins.cpoolIndex]; ok {
+			output += "; " + name
+		}
 	} else if op == op_return {
 		output = fmt.Sprintf("RETURN\t")
 	} else if op == op_setlocal {
 		output = fmt.Sprintf("SETLOCAL %d\t", ins.cpoolIndex)
 	} else if op == op_eq {
 		output = fmt.Sprintf("EQ\t")
+	} else if op == op_yield {
+		output = fmt.Sprintf("YIELD\t")
 	}
 
 	// Labels are a corner-case: we need to print that with a custom format
@@ -91,6 +286,10 @@ func printInstruction(tw *tabwriter.Writer, a *Assembler, m *Method, ins *Instru
 		return
 	}
 
+	if output == "" && ins.Opcode.operandSize() == 0 {
+		output = ins.Opcode.Mnemonic() + "\t"
+	}
+
 	if output == "" {
 		tw.Write([]byte(fmt.Sprintf("\t%04d: OP_%d [%d]\t\n", ins.address, ins.Opcode, ins.cpoolIndex)))
 	} else {
@@ -105,17 +304,31 @@ func (t VariableType) String() string {
 		return "int"
 	} else if t == VarTypeLong {
 		return "long"
+	} else if t == VarTypeFloat {
+		return "float"
 	} else if t == VarTypeBool {
 		return "bool"
 	} else if t == VarTypeVoid {
 		return "void"
 	} else if t == VarTypeUnresolved {
 		return "unresolved"
+	} else if t.native != "" {
+		return "native<" + t.native + ">"
 	} else { // We have an else case for those that are unhandled in this function, but do exist.
 		return "undefined"
 	}
 }
 
+// formatFloat formats a float the way it is written in a script, so it can be told apart from an int.
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+
+	return s
+}
+
 func TypeListToString(sep string, types ...VariableType) string {
 	// Convert list to string representation first
 	asStrings := make([]string, len(types))
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what the function prints to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = stdout
+	w.Close()
+
+	output, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(output)
+}
+
+// listingCode returns the method code of a listing, without the names and comments that only the compiler knows.
+func listingCode(listing string) []string {
+	var lines []string
+	for _, line := range strings.Split(listing[strings.Index(listing, "Method code:"):], "\n") {
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, " (id "); i >= 0 {
+			line = line[i:]
+		}
+
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+
+	return lines
+}
+
+func TestListingsAgree(t *testing.T) {
+	assembler := compileScript(t, `
+func check(int value) {
+	if (value == 1) {
+		println("one");
+	}
+
+	if (value == 2) {
+		println("two");
+	} else {
+		if (value == 3) {
+			println("three");
+		} else {
+			println("other");
+		}
+	}
+}
+
+on number_typed(1) {
+	int i = 1;
+	check(1);
+	if (handle(1) == handle(2)) {
+	}
+
+	for (int j = 0; j < 3; j = j + 1) {
+		if (j == 1) {
+			continue;
+		}
+		while (true) {
+			break;
+		}
+	}
+
+	if ((i == 1 && handle(1) == handle(2)) || !(i == 2)) {
+		println("short-circuit");
+	}
+}
+`)
+
+	bin, err := Decode(assembler.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compiled := listingCode(captureStdout(t, assembler.PrettyPrint))
+	decoded := listingCode(captureStdout(t, func() { bin.PrettyPrint(assembler.program.runtime) }))
+
+	if strings.Join(compiled, "\n") != strings.Join(decoded, "\n") {
+		t.Fatalf("compiler listing:\n%s\n\ndisasm listing:\n%s", strings.Join(compiled, "\n"), strings.Join(decoded, "\n"))
+	}
+}
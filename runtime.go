@@ -10,6 +10,12 @@ import (
 type AdderRuntime struct {
 	Functions []*RuntimeFunction
 	Listeners []*RuntimeListener
+
+	// Types are the native types scripts can access fields and methods of, such as native<Player>.
+	Types []*BaseType
+
+	// Constants are named values that scripts can use wherever a literal is accepted.
+	Constants []*RuntimeConstant
 }
 
 type RuntimeFunction struct {
@@ -17,12 +23,26 @@ type RuntimeFunction struct {
 	Name       string
 	Parameters []FunctionParameter
 	InternalId int
+
+	// Suspending functions may park the calling script, which is resumed later by the scheduler.
+	Suspending bool
 }
 
 type RuntimeListener struct {
 	Name string
 	Parameters []FunctionParameter
 	InternalId int
+
+	// Arguments are the values delivered with an event besides the parameters, which cannot be filtered on.
+	Arguments []FunctionParameter
+}
+
+// RuntimeConstant is a named value declared with 'const int NAME = value;'. The value is an int, int64, float64, string
+// or bool, the same as the value of a literal of that type.
+type RuntimeConstant struct {
+	Type  VariableType
+	Name  string
+	Value interface{}
 }
 
 type FunctionParameter struct {
@@ -30,13 +50,21 @@ type FunctionParameter struct {
 	Name string
 }
 
-var AnyType = "void|int|string|bool|native<.*>"
-var RuntimeLinePattern, _ = regexp.Compile("^\\s*(" + AnyType + "|listener)\\s+([a-zA-Z_][a-zA-Z0-9_]*)\\(([^)]*)\\)\\s*(\\((.*)\\))?\\s*->\\s*(\\d+)\\s*;$")
+var AnyType = "void|int|long|float|string|bool|native<.*>"
+var RuntimeLinePattern, _ = regexp.Compile("^\\s*(suspend\\s+)?(" + AnyType + "|listener)\\s+([a-zA-Z_][a-zA-Z0-9_]*)\\(([^)]*)\\)\\s*(\\((.*)\\))?\\s*->\\s*(\\d+)\\s*;$")
 var ParametersPattern, _ = regexp.Compile("\\s*(" + AnyType + ")\\s+([a-zA-Z_0-9]+)")
+var TypeStartPattern, _ = regexp.Compile("^type\\s+([a-zA-Z_][a-zA-Z0-9_]*)\\s*\\{$")
+var TypeFieldPattern, _ = regexp.Compile("^(readonly\\s+)?(" + AnyType + ")\\s+([a-zA-Z_][a-zA-Z0-9_]*)\\s*->\\s*(\\d+)\\s*;$")
+var TypeMethodPattern, _ = regexp.Compile("^(suspend\\s+)?(" + AnyType + ")\\s+([a-zA-Z_][a-zA-Z0-9_]*)\\(([^)]*)\\)\\s*->\\s*(\\d+)\\s*;$")
+var ConstantPattern, _ = regexp.Compile("^const\\s+([a-z]+)\\s+([a-zA-Z_][a-zA-Z0-9_]*)\\s*=\\s*(.+?)\\s*;$")
 
 func ParseRuntime(runtimeData string) (*AdderRuntime, error) {
 	runtime := AdderRuntime{}
 
+	// The native type whose members are being declared, if any
+	var currentType *BaseType
+	typeLine := 0
+
 	lines := strings.Split(runtimeData, "\n")
 	for lineNumber, line := range lines {
 		line = strings.TrimSpace(line)
@@ -46,15 +74,45 @@ func ParseRuntime(runtimeData string) (*AdderRuntime, error) {
 			continue
 		}
 
+		if currentType != nil {
+			if line == "}" {
+				runtime.Types = append(runtime.Types, currentType)
+				currentType = nil
+				continue
+			}
+
+			if err := parseTypeMember(currentType, line); err != nil {
+				return nil, fmt.Errorf("error parsing member of type %s at line %d: %s", currentType.Name, lineNumber+1, err)
+			}
+			continue
+		}
+
+		if matches := TypeStartPattern.FindStringSubmatch(line); matches != nil {
+			currentType = &BaseType{Name: matches[1], Native: true}
+			typeLine = lineNumber + 1
+			continue
+		}
+
+		if matches := ConstantPattern.FindStringSubmatch(line); matches != nil {
+			constant, err := parseConstant(matches[1], matches[2], matches[3])
+			if err != nil {
+				return nil, fmt.Errorf("error parsing constant at line %d: %s", lineNumber+1, err)
+			}
+
+			runtime.Constants = append(runtime.Constants, constant)
+			continue
+		}
+
 		matches := RuntimeLinePattern.FindAllStringSubmatch(line, -1)
-		if len(matches) == 1 && len(matches[0]) >= 6 {
+		if len(matches) == 1 && len(matches[0]) >= 7 {
 			groups := matches[0][1:]
 
-			returnType := groups[0]
-			methodName := groups[1]
-			parameters := groups[2]
-			incomingParameters := groups[4]
-			uid := groups[5]
+			suspending := groups[0] != ""
+			returnType := groups[1]
+			methodName := groups[2]
+			parameters := groups[3]
+			incomingParameters := groups[5]
+			uid := groups[6]
 
 			uidInt, err := strconv.Atoi(uid)
 			if err != nil {
@@ -68,13 +126,14 @@ func ParseRuntime(runtimeData string) (*AdderRuntime, error) {
 			}
 
 			if returnType == "listener" {
-				// Parse listener parameters if any
-				if len(incomingParameters) > 1 {
-					incoming, err := parseParameters(incomingParameters)
-					if err != nil {
-						return nil, fmt.Errorf("cannot parse listener receiving parameters (%s): %s", incomingParameters, err)
-					}
-					fmt.Printf("%+v\n", incoming)
+				if suspending {
+					return nil, fmt.Errorf("listener at line %d cannot be marked as suspending", lineNumber+1)
+				}
+
+				// Parse the arguments delivered with the event, if any
+				incoming, err := parseParameters(incomingParameters)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse listener receiving parameters (%s): %s", incomingParameters, err)
 				}
 
 				// Put the new listener into the list of listeners.
@@ -82,6 +141,7 @@ func ParseRuntime(runtimeData string) (*AdderRuntime, error) {
 					Name:       methodName,
 					Parameters: parsedParameters,
 					InternalId: uidInt,
+					Arguments:  incoming,
 				}
 
 				runtime.Listeners = append(runtime.Listeners, listener)
@@ -98,6 +158,7 @@ func ParseRuntime(runtimeData string) (*AdderRuntime, error) {
 					Name:       methodName,
 					Parameters: parsedParameters,
 					InternalId: uidInt,
+					Suspending: suspending,
 				}
 
 				runtime.Functions = append(runtime.Functions, function)
@@ -107,6 +168,10 @@ func ParseRuntime(runtimeData string) (*AdderRuntime, error) {
 		}
 	}
 
+	if currentType != nil {
+		return nil, fmt.Errorf("type %s declared at line %d is missing its closing '}'", currentType.Name, typeLine)
+	}
+
 	// Validate the runtime
 	if err := runtime.ValidateRuntime(); err != nil {
 		return nil, err
@@ -145,9 +210,141 @@ func (rt AdderRuntime) ValidateRuntime() error {
 		uniques[v.InternalId] = true
 	}
 
+	// Constant names are unique, as scripts refer to them by name
+	constants := map[string]bool{}
+	for _, v := range rt.Constants {
+		if constants[v.Name] {
+			return fmt.Errorf("cannot validate runtime because constant '%s' is already defined", v.Name)
+		}
+
+		constants[v.Name] = true
+	}
+
+	// Field and method ids are unique across all types, as the instructions using them do not name the type
+	fields := map[int]bool{}
+	methods := map[int]bool{}
+	types := map[string]bool{}
+	for _, t := range rt.Types {
+		if types[t.Name] || ResolveType(t.Name) != VarTypeUnresolved {
+			return fmt.Errorf("cannot validate runtime because type '%s' is already defined", t.Name)
+		}
+		types[t.Name] = true
+
+		for _, v := range t.Fields {
+			if v.InternalId < 0 || fields[v.InternalId] {
+				return fmt.Errorf("cannot validate runtime because field '%s.%s' has a negative or already existing ID %d", t.Name, v.Name, v.InternalId)
+			}
+
+			fields[v.InternalId] = true
+		}
+
+		for _, v := range t.Methods {
+			if v.InternalId < 0 || methods[v.InternalId] {
+				return fmt.Errorf("cannot validate runtime because method '%s.%s' has a negative or already existing ID %d", t.Name, v.Name, v.InternalId)
+			}
+
+			methods[v.InternalId] = true
+		}
+	}
+
 	return nil
 }
 
+// parseTypeMember parses a single field or method declaration inside a type block, and adds it to the type.
+func parseTypeMember(typ *BaseType, line string) error {
+	if matches := TypeFieldPattern.FindStringSubmatch(line); matches != nil {
+		fieldType := ResolveVarType(matches[2])
+		if fieldType == VarTypeUnresolved {
+			return fmt.Errorf("invalid type for field %s: %s", matches[3], matches[2])
+		}
+
+		uid, err := strconv.Atoi(matches[4])
+		if err != nil {
+			return fmt.Errorf("cannot convert uid into number: %s (%s)", matches[4], err)
+		}
+
+		if typ.ResolveField(matches[3]) != nil || typ.ResolveMethod(matches[3]) != nil {
+			return fmt.Errorf("member %s is declared twice", matches[3])
+		}
+
+		typ.Fields = append(typ.Fields, TypeField{
+			Type:       fieldType,
+			Name:       matches[3],
+			InternalId: uid,
+			ReadOnly:   matches[1] != "",
+		})
+		return nil
+	}
+
+	if matches := TypeMethodPattern.FindStringSubmatch(line); matches != nil {
+		returnType := ResolveType(matches[2])
+		if returnType == VarTypeUnresolved {
+			return fmt.Errorf("invalid return type for method %s: %s", matches[3], matches[2])
+		}
+
+		uid, err := strconv.Atoi(matches[5])
+		if err != nil {
+			return fmt.Errorf("cannot convert uid into number: %s (%s)", matches[5], err)
+		}
+
+		parameters, err := parseParameters(matches[4])
+		if err != nil {
+			return err
+		}
+
+		if typ.ResolveField(matches[3]) != nil || typ.ResolveMethod(matches[3]) != nil {
+			return fmt.Errorf("member %s is declared twice", matches[3])
+		}
+
+		method := TypeMethod{
+			Name:       matches[3],
+			Returns:    returnType,
+			InternalId: uid,
+			Suspending: matches[1] != "",
+		}
+		for _, v := range parameters {
+			method.Parameters = append(method.Parameters, MethodParameter{Name: v.Name, Type: v.Type})
+		}
+
+		typ.Methods = append(typ.Methods, method)
+		return nil
+	}
+
+	return fmt.Errorf("invalid field or method declaration")
+}
+
+// parseConstant parses the value of a constant declaration, written the same way as a literal in a script.
+func parseConstant(typ string, name string, value string) (*RuntimeConstant, error) {
+	constant := &RuntimeConstant{Type: ResolveVarType(typ), Name: name}
+
+	var err error
+	switch constant.Type {
+	case VarTypeInt:
+		var v int64
+		v, err = strconv.ParseInt(value, 10, 32)
+		constant.Value = int(v)
+	case VarTypeLong:
+		constant.Value, err = strconv.ParseInt(value, 10, 64)
+	case VarTypeFloat:
+		constant.Value, err = strconv.ParseFloat(value, 64)
+	case VarTypeString:
+		constant.Value, err = strconv.Unquote(value)
+	case VarTypeBool:
+		constant.Value = value == "true"
+		if value != "true" && value != "false" {
+			err = strconv.ErrSyntax
+		}
+	default:
+		return nil, fmt.Errorf("invalid type for constant %s: %s, it must be int, long, float, string or bool", name, typ)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value for constant %s: %s", typ, name, value)
+	}
+
+	return constant, nil
+}
+
 // parseParameters parses a single parameters string into an array of parameters.
 func parseParameters(parameters string) ([]FunctionParameter, error) {
 	var result []FunctionParameter
@@ -219,6 +416,64 @@ func (r *AdderRuntime) FindFunctionById(uid int) *RuntimeFunction {
 	return nil
 }
 
+// FindType finds the native type with the given name, as used in native<Name>.
+func (r *AdderRuntime) FindType(name string) *BaseType {
+	for _, v := range r.Types {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// FindFieldById finds a field of any native type by its internal id.
+func (r *AdderRuntime) FindFieldById(uid int) (*BaseType, *TypeField) {
+	for _, t := range r.Types {
+		for i := range t.Fields {
+			if t.Fields[i].InternalId == uid {
+				return t, &t.Fields[i]
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// FindMethodById finds a method of any native type by its internal id.
+func (r *AdderRuntime) FindMethodById(uid int) (*BaseType, *TypeMethod) {
+	for _, t := range r.Types {
+		for i := range t.Methods {
+			if t.Methods[i].InternalId == uid {
+				return t, &t.Methods[i]
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// FindConstant finds the constant with the given name.
+func (r *AdderRuntime) FindConstant(name string) *RuntimeConstant {
+	for _, v := range r.Constants {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func (r *AdderRuntime) FindListenerById(uid int) *RuntimeListener {
+	for _, v := range r.Listeners {
+		if v.InternalId == uid {
+			return v
+		}
+	}
+
+	return nil
+}
+
 func (r *AdderRuntime) FindListener(name string) *RuntimeListener {
 	for _, v := range r.Listeners {
 		if v.Name == name {
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRuntimeTypes(t *testing.T) {
+	runtime, err := ParseRuntime(`
+native<Door> door(string name) -> 1;
+
+type Door {
+	string name -> 1;
+	readonly bool open -> 2;
+	native<Door> next -> 3;
+	void close() -> 1;
+	suspend void do_animation(string animation, int speed) -> 2;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	door := runtime.FindType("Door")
+	if door == nil || len(door.Fields) != 3 || len(door.Methods) != 2 {
+		t.Fatalf("unexpected type %+v", door)
+	}
+
+	if f := door.ResolveField("open"); f == nil || f.Type != VarTypeBool || !f.ReadOnly || f.InternalId != 2 {
+		t.Errorf("unexpected field %+v", f)
+	}
+
+	if f := door.ResolveField("next"); f == nil || f.Type.native != "Door" || f.ReadOnly {
+		t.Errorf("unexpected field %+v", f)
+	}
+
+	m := door.ResolveMethod("do_animation")
+	if m == nil || !m.Suspending || m.Returns != VarTypeVoid || len(m.Parameters) != 2 || m.Parameters[1].Type != VarTypeInt {
+		t.Errorf("unexpected method %+v", m)
+	}
+
+	for _, test := range []struct {
+		definition string
+		err        string
+	}{
+		{"type Door {\n\tstring name -> 1;\n", "missing its closing"},
+		{"type Door {\n\tstring name;\n}", "member of type Door"},
+		{"type Door {\n\tthing name -> 1;\n}", "member of type Door"},
+		{"type Door {\n\tstring name -> 1;\n\tint id -> 1;\n}", "already existing ID"},
+		{"type Door {\n}\ntype Door {\n}", "already defined"},
+		{"type int {\n}", "already defined"},
+	} {
+		if _, err := ParseRuntime(test.definition); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected an error containing %q for:\n%s\ngot %v", test.err, test.definition, err)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package main
 
+import (
+	"bytes"
+	"strconv"
+)
+
 type tokenType int
 type char uint8
 
@@ -13,14 +18,18 @@ const (
 	tokenFunc            // The 'func' keyword indicating a new method
 	tokenIf
 	tokenElse
-	tokenLParen                   // Left parenthesis '('
-	tokenRParen                   // Right parenthesis ')'
-	tokenInteger                 // An integer literal
-	tokenSemicolon             // A semicolon ';'
+	tokenLParen    // Left parenthesis '('
+	tokenRParen    // Right parenthesis ')'
+	tokenInteger   // An integer literal
+	tokenFloat     // A floating-point literal, such as 1.5
+	tokenSemicolon // A semicolon ';'
 	tokenLBrack
 	tokenRBrack
 	tokenAssign
-	tokenString                   // A string literal
+	tokenString       // A string literal, or a raw string literal between backticks
+	tokenStringStart  // The text of a string literal up to its first ${, such as "Hello ${
+	tokenStringMiddle // The text of a string literal between two interpolations, such as }, ${
+	tokenStringEnd    // The text of a string literal after its last interpolation, such as }!"
 	tokenBool
 	tokenComma
 	tokenMinus
@@ -35,8 +44,37 @@ const (
 	tokenDivide
 	tokenMultiply
 	tokenModulo
+	tokenWhile
+	tokenFor
+	tokenBreak
+	tokenContinue
+	tokenReturn
+	tokenAnd
+	tokenOr
+	tokenDot
+	tokenPipe
+	tokenConst
+	tokenPersist
 )
 
+// tokenNames holds the source text of operator tokens, for use in error messages.
+var tokenNames = map[tokenType]string{
+	tokenEqual:          "==",
+	tokenNotEqual:       "!=",
+	tokenLessThan:       "<",
+	tokenGreaterThan:    ">",
+	tokenLessOrEqual:    "<=",
+	tokenGreaterOrEqual: ">=",
+	tokenNot:            "!",
+	tokenPlus:           "+",
+	tokenMinus:          "-",
+	tokenDivide:         "/",
+	tokenMultiply:       "*",
+	tokenModulo:         "%",
+	tokenAnd:            "&&",
+	tokenOr:             "||",
+}
+
 type scanAction func(*scanner) scanAction
 
 type token struct {
@@ -53,6 +91,11 @@ type scanner struct {
 	mark    int
 	tokens  chan token
 	state   scanAction
+
+	// interpolations is the number of ${ in string literals that have not been closed yet.
+	interpolations int
+
+	diagnostics []Diagnostic
 }
 
 func (s *scanner) markPosition(offset int) {
@@ -73,6 +116,10 @@ func (s *scanner) rewind(num int) {
 }
 
 func (s *scanner) peek(num int) char {
+	if s.pos+num >= len(s.data) {
+		return eof
+	}
+
 	return char(s.data[s.pos+num])
 }
 
@@ -103,15 +150,27 @@ func (s *scanner) makeToken(t tokenType) {
 	}
 }
 
+// error reports a problem with the text scanned since the last mark.
+func (s *scanner) error(code DiagnosticCode, format string, args ...interface{}) {
+	s.errorAt(Span{s.mark, s.pos}, code, format, args...)
+}
+
+// errorAt reports a problem with the text at the given span.
+func (s *scanner) errorAt(span Span, code DiagnosticCode, format string, args ...interface{}) {
+	s.diagnostics = append(s.diagnostics, newError(code, span, format, args...))
+}
+
 func scanAny(s *scanner) scanAction {
 	c := s.current()
 	if c == eof {
+		s.markPosition(0)
 		s.makeToken(tokenEOF)
 		return nil
 	}
 
 	for {
 		if c == 0 || c == eof {
+			s.markPosition(0)
 			s.makeToken(tokenEOF)
 			return nil
 		} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
@@ -141,6 +200,8 @@ func scanAny(s *scanner) scanAction {
 		}
 	} else if c == '"' {
 		return scanString
+	} else if c == '`' {
+		return scanRawString
 	} else if c == '(' {
 		s.next()
 		s.makeToken(tokenLParen)
@@ -153,6 +214,10 @@ func scanAny(s *scanner) scanAction {
 		s.next()
 		s.makeToken(tokenLBrack)
 		return scanAny
+	} else if c == '}' && s.interpolations > 0 {
+		s.interpolations--
+		s.next()
+		return scanStringContents(s, tokenStringEnd, tokenStringMiddle)
 	} else if c == '}' {
 		s.next()
 		s.makeToken(tokenRBrack)
@@ -174,7 +239,8 @@ func scanAny(s *scanner) scanAction {
 
 		return scanAny
 	} else if c == '!' {
-		c = s.next()
+		s.next()
+		c = s.peek(0)
 
 		if c == '=' {
 			s.next()
@@ -185,7 +251,8 @@ func scanAny(s *scanner) scanAction {
 
 		return scanAny
 	} else if c == '<' {
-		c = s.next()
+		s.next()
+		c = s.peek(0)
 
 		if c == '=' {
 			s.next()
@@ -196,7 +263,8 @@ func scanAny(s *scanner) scanAction {
 
 		return scanAny
 	} else if c == '>' {
-		c = s.next()
+		s.next()
+		c = s.peek(0)
 
 		if c == '=' {
 			s.next()
@@ -210,15 +278,28 @@ func scanAny(s *scanner) scanAction {
 		s.next()
 		s.makeToken(tokenComma)
 		return scanAny
+	} else if c == '.' {
+		s.next()
+		s.makeToken(tokenDot)
+		return scanAny
 	} else if c == '-' {
+		// Negative literals are folded by the parser, so 'a-1' is a subtraction
 		s.next()
-
-		if isIntegerChar(s.current()) {
-			return scanIntegerLiteral
+		s.makeToken(tokenMinus)
+		return scanAny
+	} else if (c == '&' || c == '|') && s.peek(1) == c {
+		s.next()
+		s.next()
+		if c == '&' {
+			s.makeToken(tokenAnd)
 		} else {
-			s.makeToken(tokenMinus)
-			return scanAny
+			s.makeToken(tokenOr)
 		}
+		return scanAny
+	} else if c == '|' {
+		s.next()
+		s.makeToken(tokenPipe)
+		return scanAny
 	} else if c == '+' {
 		s.next()
 		s.makeToken(tokenPlus)
@@ -239,21 +320,19 @@ func scanAny(s *scanner) scanAction {
 		return scanIntegerLiteral
 	}
 
-	s.rewind(1)
-	fragmentEnd := s.pos + 10
-	if fragmentEnd > len(s.data) {
-		fragmentEnd = len(s.data)
-	}
-
-	panic("unknown char: " + string(c) + "; data: " + s.data[s.pos:fragmentEnd])
-	return nil
+	// Skip the character so scanning can continue, and report it.
+	s.next()
+	s.error(ErrUnknownChar, "unknown character %q", rune(c))
+	return scanAny
 }
 
 func scanSingleComment(s *scanner) scanAction {
 	for {
 		c := s.next()
 
-		if c == '\n' || c == eof {
+		if c == eof {
+			break
+		} else if c == '\n' {
 			s.rewind(1)
 			break
 		}
@@ -271,7 +350,6 @@ func scanMultilineComment(s *scanner) scanAction {
 			s.next(); s.next() // consume both * and /
 			break
 		} else if c == eof {
-			s.rewind(1)
 			break
 		}
 	}
@@ -280,12 +358,123 @@ func scanMultilineComment(s *scanner) scanAction {
 	return scanAny
 }
 
+// scanString scans a string literal. A string containing ${expression} is split up around the expressions, which are
+// scanned as regular tokens in between the parts of the string.
 func scanString(s *scanner) scanAction {
-	c := s.next()
+	s.next() // consume '"'
+	return scanStringContents(s, tokenString, tokenStringStart)
+}
 
+// scanStringContents scans the text of a string literal, up to the closing quote or the next ${. The part of the string
+// is made a token of type closed or interpolated respectively. A string that is not closed on the line it starts on is
+// reported, and ends at the end of the line.
+func scanStringContents(s *scanner, closed tokenType, interpolated tokenType) scanAction {
 	for {
-		c = s.next()
-		if c == '"' { // TODO EOL/EOF
+		c := s.next()
+		if c == '"' {
+			s.makeToken(closed)
+			return scanAny
+		} else if c == '\n' || c == eof {
+			if c == '\n' {
+				s.rewind(1)
+			}
+
+			s.error(ErrUnterminatedString, "unterminated string literal, strings spanning several lines have to be written between backticks")
+			s.makeToken(closed)
+			return scanAny
+		} else if c == '\\' {
+			scanEscape(s)
+		} else if c == '$' && s.current() == '{' {
+			s.next()
+			s.makeToken(interpolated)
+			s.interpolations++
+			return scanAny
+		}
+	}
+}
+
+// escapes holds the characters that can follow a backslash in a string literal, and what they stand for. A \u is
+// followed by the four hex digits of a unicode code point instead.
+var escapes = map[char]string{
+	'n':  "\n",
+	't':  "\t",
+	'r':  "\r",
+	'"':  "\"",
+	'\\': "\\",
+	'$':  "$",
+}
+
+// scanEscape scans an escape sequence in a string literal, of which the backslash has already been consumed. An escape
+// that is not valid is reported, but is scanned as part of the string regardless.
+func scanEscape(s *scanner) {
+	start := s.pos - 1
+	c := s.current()
+
+	if _, ok := escapes[c]; ok {
+		s.next()
+		return
+	} else if c == '\n' || c == eof {
+		// The string is unterminated, which is reported instead
+		return
+	}
+
+	s.next()
+	if c == 'u' {
+		for i := 0; i < 4; i++ {
+			if !isHexChar(s.current()) {
+				s.errorAt(Span{start, s.pos}, ErrInvalidEscape, "invalid escape sequence, \\u has to be followed by four hex digits")
+				return
+			}
+			s.next()
+		}
+		return
+	}
+
+	s.errorAt(Span{start, s.pos}, ErrInvalidEscape, "invalid escape sequence \\%c, expected one of: \\n, \\t, \\r, \\\", \\\\, \\$, \\u", rune(c))
+}
+
+// unescape returns the value of the text of a string literal, written without its quotes. Escape sequences that are not
+// valid have already been reported by the scanner, and are kept as they are.
+func unescape(text string) string {
+	var value bytes.Buffer
+
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 == len(text) {
+			value.WriteByte(text[i])
+			continue
+		}
+
+		if v, ok := escapes[char(text[i+1])]; ok {
+			value.WriteString(v)
+			i++
+			continue
+		}
+
+		if text[i+1] == 'u' && i+6 <= len(text) {
+			if code, err := strconv.ParseUint(text[i+2:i+6], 16, 32); err == nil {
+				value.WriteRune(rune(code))
+				i += 5
+				continue
+			}
+		}
+
+		value.WriteByte(text[i])
+	}
+
+	return value.String()
+}
+
+// scanRawString scans a raw string literal between backticks. Raw strings may span several lines, and their text is
+// taken as it is, without escape sequences or interpolation.
+func scanRawString(s *scanner) scanAction {
+	s.next() // consume '`'
+
+	for {
+		c := s.next()
+		if c == '`' {
+			break
+		} else if c == eof {
+			s.error(ErrUnterminatedString, "unterminated raw string literal")
 			break
 		}
 	}
@@ -306,11 +495,18 @@ func isIntegerChar(c char) bool {
 	return c >= '0' && c <= '9'
 }
 
+func isHexChar(c char) bool {
+	return isIntegerChar(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
 func scanIdentifier(s *scanner) scanAction {
 	for {
 		c := s.next()
 		if !isIdentifierChar(c) {
-			s.rewind(1)
+			// At the end of the text nothing was consumed, so there is nothing to give back
+			if c != eof {
+				s.rewind(1)
+			}
 			break
 		}
 	}
@@ -324,6 +520,20 @@ func scanIdentifier(s *scanner) scanAction {
 		s.makeToken(tokenIf)
 	} else if value == "else" {
 		s.makeToken(tokenElse)
+	} else if value == "while" {
+		s.makeToken(tokenWhile)
+	} else if value == "for" {
+		s.makeToken(tokenFor)
+	} else if value == "break" {
+		s.makeToken(tokenBreak)
+	} else if value == "continue" {
+		s.makeToken(tokenContinue)
+	} else if value == "return" {
+		s.makeToken(tokenReturn)
+	} else if value == "const" {
+		s.makeToken(tokenConst)
+	} else if value == "persist" {
+		s.makeToken(tokenPersist)
 	} else if value == "true" || value == "false" {
 		s.makeToken(tokenBool)
 	} else {
@@ -334,22 +544,26 @@ func scanIdentifier(s *scanner) scanAction {
 }
 
 func scanIntegerLiteral(s *scanner) scanAction {
-	if s.current() == '-' {
-		s.next()
-	}
+	s.skipDigits()
 
-	for {
-		c := s.next()
-		if !isIntegerChar(c) {
-			s.rewind(1)
-			break
-		}
+	// A point followed by more digits makes it a float, anything else after it is left to the next token
+	if s.current() == '.' && isIntegerChar(s.peek(1)) {
+		s.next()
+		s.skipDigits()
+		s.makeToken(tokenFloat)
+		return scanAny
 	}
 
 	s.makeToken(tokenInteger)
 	return scanAny
 }
 
+func (s *scanner) skipDigits() {
+	for isIntegerChar(s.current()) {
+		s.next()
+	}
+}
+
 func (s *scanner) run() {
 	for s.state = scanAny; s.state != nil; {
 		s.state = s.state(s)
@@ -358,7 +572,8 @@ func (s *scanner) run() {
 	close(s.tokens)
 }
 
-func ScanText(text string) []token {
+// ScanText splits the text into tokens. Characters that cannot start any token are skipped and reported.
+func ScanText(text string) ([]token, []Diagnostic) {
 	s := scanner{
 		data:   text,
 		tokens: make(chan token),
@@ -371,5 +586,5 @@ func ScanText(text string) []token {
 		tokens = append(tokens, v)
 	}
 
-	return tokens
+	return tokens, s.diagnostics
 }
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestScanEndOfText(t *testing.T) {
+	for _, test := range []struct {
+		source string
+		last   tokenType
+		value  string
+	}{
+		{"int x", tokenIdentifier, "x"},
+		{"on number_typed(1) { x", tokenIdentifier, "x"},
+		{"int x = 12", tokenInteger, "12"},
+		{"int x = 1; // comment", tokenSemicolon, ";"},
+		{"int x = 1; /* unterminated", tokenSemicolon, ";"},
+	} {
+		tokens, diagnostics := ScanText(test.source)
+		if len(diagnostics) != 0 {
+			t.Errorf("unexpected diagnostics for %q: %v", test.source, diagnostics)
+			continue
+		}
+
+		if len(tokens) < 2 || tokens[len(tokens)-1].tokenType != tokenEOF {
+			t.Errorf("expected %q to end with an EOF token, got %v", test.source, tokens)
+			continue
+		}
+
+		if last := tokens[len(tokens)-2]; last.tokenType != test.last || last.value != test.value {
+			t.Errorf("expected %q to end with %q, got %q", test.source, test.value, last.value)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	script := loadScript(t, "on program_start() {\r\n"+
+		"\tprintln(\"quote \\\" backslash \\\\ tab \\t dollar \\${x} \\u00e9\");\r\n"+
+		"\tprintln(`raw \\n ${x}\r\nsecond line`);\r\n"+
+		"}\r\n")
+
+	if err := script.vm.Dispatch(1); err != nil {
+		t.Fatal(err)
+	}
+
+	script.expectOutput(t, "quote \" backslash \\ tab \t dollar ${x} é", "raw \\n ${x}\nsecond line")
+
+	for _, test := range []struct {
+		source string
+		code   DiagnosticCode
+		column int
+	}{
+		{"on program_start() { println(\"abc);\n}", ErrUnterminatedString, 30},
+		{"on program_start() { println(\"abc", ErrUnterminatedString, 30},
+		{"on program_start() { println(`abc", ErrUnterminatedString, 30},
+		{"on program_start() { println(\"a ${1} b\n); }", ErrUnterminatedString, 36},
+		{"on program_start() { println(\"a\\qb\"); }", ErrInvalidEscape, 32},
+		{"on program_start() { println(\"a\\u12\"); }", ErrInvalidEscape, 32},
+	} {
+		diagnostics := compileErrors(t, test.source)
+		if d := diagnostics[0]; d.Code != test.code || d.Line != 1 || d.Column != test.column {
+			t.Errorf("%q: got %s, expected %s at column %d", test.source, d.Error(), test.code, test.column)
+		}
+	}
+}
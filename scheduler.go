@@ -0,0 +1,140 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Scheduler keeps track of suspended script instances and resumes them once their wake condition is met. Instances
+// waiting for a tick and instances waiting for a wall-clock deadline are kept in separate priority queues, so a tick
+// only touches the instances that are actually due. A Scheduler is not safe for concurrent use; it is meant to be
+// driven from the game loop.
+type Scheduler struct {
+	tick   uint64
+	byTick tickQueue
+	byTime timeQueue
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// CurrentTick returns the number of ticks processed so far.
+func (s *Scheduler) CurrentTick() uint64 {
+	return s.tick
+}
+
+// Len returns the number of instances currently suspended.
+func (s *Scheduler) Len() int {
+	return len(s.byTick) + len(s.byTime)
+}
+
+// Dispatch starts every trigger matching the event. Instances that suspend are kept until they are due.
+func (s *Scheduler) Dispatch(vm *Interpreter, listenerId int, values ...interface{}) error {
+	instances, err := vm.Instances(listenerId, values...)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, instance := range instances {
+		if err := s.Start(instance); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Start runs an instance until it finishes or suspends. A suspended instance is queued until its wake condition is met.
+func (s *Scheduler) Start(instance *ScriptInstance) error {
+	instance.sleepTicks = 0
+	instance.sleepUntil = time.Time{}
+
+	if err := instance.Run(); err != nil {
+		return err
+	}
+
+	if instance.Suspended() {
+		s.park(instance)
+	}
+
+	return nil
+}
+
+// Tick advances the scheduler by one game tick and resumes every instance that is due by tick count or by the given
+// wall-clock time. A failing instance is dropped; the first error is returned after all due instances have run.
+func (s *Scheduler) Tick(now time.Time) error {
+	s.tick++
+
+	// Collect first, so instances that suspend again during this tick are not resumed twice.
+	var due []*ScriptInstance
+	for len(s.byTick) > 0 && s.byTick[0].wakeTick <= s.tick {
+		due = append(due, heap.Pop(&s.byTick).(*ScriptInstance))
+	}
+	for len(s.byTime) > 0 && !s.byTime[0].sleepUntil.After(now) {
+		due = append(due, heap.Pop(&s.byTime).(*ScriptInstance))
+	}
+
+	var firstErr error
+	for _, instance := range due {
+		if err := s.Start(instance); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (s *Scheduler) park(instance *ScriptInstance) {
+	if !instance.sleepUntil.IsZero() {
+		heap.Push(&s.byTime, instance)
+		return
+	}
+
+	ticks := instance.sleepTicks
+	if ticks < 1 {
+		ticks = 1
+	}
+
+	instance.wakeTick = s.tick + uint64(ticks)
+	heap.Push(&s.byTick, instance)
+}
+
+// tickQueue is a min-heap of instances ordered by the tick they wake up at.
+type tickQueue []*ScriptInstance
+
+func (q tickQueue) Len() int           { return len(q) }
+func (q tickQueue) Less(i, j int) bool { return q[i].wakeTick < q[j].wakeTick }
+func (q tickQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *tickQueue) Push(x interface{}) {
+	*q = append(*q, x.(*ScriptInstance))
+}
+
+func (q *tickQueue) Pop() interface{} {
+	old := *q
+	instance := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return instance
+}
+
+// timeQueue is a min-heap of instances ordered by their wall-clock deadline.
+type timeQueue []*ScriptInstance
+
+func (q timeQueue) Len() int           { return len(q) }
+func (q timeQueue) Less(i, j int) bool { return q[i].sleepUntil.Before(q[j].sleepUntil) }
+func (q timeQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *timeQueue) Push(x interface{}) {
+	*q = append(*q, x.(*ScriptInstance))
+}
+
+func (q *timeQueue) Pop() interface{} {
+	old := *q
+	instance := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return instance
+}
@@ -1,36 +1,5 @@
 package main
 
-var TypeInt = BaseType{Name: "int", BuiltIn: true}
-var TypeString = BaseType{Name: "string", BuiltIn: true}
-var TypeVoid = BaseType{Name: "void", BuiltIn: true}
-
-var TypePlayer = BaseType{
-	Name: "Player",
-	Fields: []TypeField{
-		{
-			Name: "name",
-			Type: TypeString,
-		},
-	},
-	Methods: []TypeMethod{
-		// void teleport(int x, int y)
-		{
-			Name:    "teleport",
-			Returns: TypeVoid,
-			Parameters: []MethodParameter{
-				{
-					Name: "x",
-					Type: TypeInt,
-				},
-				{
-					Name: "z",
-					Type: TypeInt,
-				},
-			},
-		},
-	},
-}
-
 type BaseType struct {
 	Name    string
 	Fields  []TypeField
@@ -84,18 +53,30 @@ func (t BaseType) ResolveMethod(name string) *TypeMethod {
 	return nil
 }
 
+// TypeField is a field of a native type. Reads and writes compile to GETFIELD and SETFIELD with the internal id, which
+// is unique among the fields of all types in the runtime.
 type TypeField struct {
-	Type BaseType
-	Name string
+	Type       VariableType
+	Name       string
+	InternalId int
+
+	// ReadOnly fields can be read by scripts, but not assigned to.
+	ReadOnly bool
 }
 
+// TypeMethod is a method of a native type. Calls compile to INVOKE with the internal id, which is unique among the
+// methods of all types in the runtime.
 type TypeMethod struct {
 	Name       string
 	Parameters []MethodParameter
-	Returns    BaseType
+	Returns    VariableType
+	InternalId int
+
+	// Suspending methods may park the calling script, like suspending runtime functions.
+	Suspending bool
 }
 
 type MethodParameter struct {
 	Name string
-	Type BaseType
+	Type VariableType
 }
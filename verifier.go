@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// VerifyError describes why a binary was rejected by Verify. Address is the instruction at fault, or -1 for problems
+// with the tables of the binary.
+type VerifyError struct {
+	Address int
+	Message string
+}
+
+func (e *VerifyError) Error() string {
+	if e.Address < 0 {
+		return "verification failed: " + e.Message
+	}
+
+	return fmt.Sprintf("verification failed at %04d: %s", e.Address, e.Message)
+}
+
+// callEffect is the effect a method has on the operand stack of its caller: it needs at least required values on the
+// stack, and leaves the stack net values higher (or lower, for a negative net) once it returns. A method that never
+// returns, such as a trigger polling in an endless loop, has no net effect, and ends every path that calls it.
+type callEffect struct {
+	required int
+	net      int
+	returns  bool
+}
+
+type verifier struct {
+	bin     *Binary
+	runtime *AdderRuntime
+
+	// entries holds the methods by entry address.
+	entries map[int]*BinaryMethod
+
+	// effects holds the stack effect of every method analyzed so far, by entry address.
+	effects map[int]*callEffect
+}
+
+// Verify checks a decoded binary before it is executed, so that a malformed or hostile binary cannot make the
+// interpreter misbehave. Every operand has to refer to something that exists: jumps and calls stay within the code,
+// constants, globals and locals exist, and native functions, fields, methods and listeners are defined by the runtime.
+// The stack depth at each instruction has to be the same along every path leading to it, and may never drop below
+// what an instruction pops. The frame sizes in the method table have to cover the locals and stack the code uses.
+// Methods may run forever, as long as their code is otherwise valid.
+func Verify(bin *Binary, runtime *AdderRuntime) error {
+	v := &verifier{
+		bin:     bin,
+		runtime: runtime,
+		entries: map[int]*BinaryMethod{},
+		effects: map[int]*callEffect{},
+	}
+
+	if err := v.verifyTables(); err != nil {
+		return err
+	}
+
+	for i, ins := range bin.Code {
+		if err := v.verifyOperand(i, ins); err != nil {
+			return err
+		}
+	}
+
+	return v.verifyStack()
+}
+
+func (v *verifier) fail(address int, format string, args ...interface{}) error {
+	return &VerifyError{Address: address, Message: fmt.Sprintf(format, args...)}
+}
+
+// verifyTables checks the trigger and method tables.
+func (v *verifier) verifyTables() error {
+	for i, m := range v.bin.Methods {
+		if m.Entry < 0 || m.Entry >= len(v.bin.Code) {
+			return v.fail(-1, "method %d has entry address %d outside of the code", i, m.Entry)
+		}
+
+		if v.entries[m.Entry] != nil {
+			return v.fail(-1, "method %d has the same entry address %d as another method", i, m.Entry)
+		}
+
+		if m.Arguments > m.Locals {
+			return v.fail(-1, "method %d takes %d arguments, but only has %d locals to store them in", i, m.Arguments, m.Locals)
+		}
+
+		if m.Arguments > m.MaxStack {
+			return v.fail(-1, "method %d takes %d arguments, but its stack only has room for %d", i, m.Arguments, m.MaxStack)
+		}
+
+		v.entries[m.Entry] = m
+	}
+
+	for i, t := range v.bin.Triggers {
+		listener := v.runtime.FindListenerById(t.ListenerId)
+		if listener == nil {
+			return v.fail(-1, "trigger %d listens to listener %d, which the runtime does not define", i, t.ListenerId)
+		}
+
+		if len(t.Values) > len(listener.Parameters) {
+			return v.fail(-1, "trigger %d has %d filter values, but %s only takes %d", i, len(t.Values), listener.Name, len(listener.Parameters))
+		}
+
+		if m := v.entries[t.Address]; m == nil {
+			return v.fail(-1, "trigger %d starts at address %d, which is not a method entry", i, t.Address)
+		} else if m.Arguments != 0 {
+			return v.fail(-1, "trigger %d starts a method taking %d arguments, but triggers are not called with any", i, m.Arguments)
+		}
+	}
+
+	return nil
+}
+
+// verifyOperand checks that the operand of an instruction refers to something that exists.
+func (v *verifier) verifyOperand(address int, ins *Instruction) error {
+	operand := ins.cpoolIndex
+	if _, ok := opcodeNames[ins.Opcode]; !ok {
+		return v.fail(address, "unknown opcode %d", ins.Opcode)
+	}
+
+	switch ins.Opcode {
+	case op_jmp, op_jz:
+		if operand < 0 || operand >= len(v.bin.Code) {
+			return v.fail(address, "%s to address %d outside of the code", ins.Opcode.Mnemonic(), operand)
+		}
+	case op_call:
+		if v.entries[operand] == nil {
+			return v.fail(address, "CALL to address %d, which is not a method entry", operand)
+		}
+	case op_pushconst:
+		if operand < 0 || operand >= len(v.bin.Constants) {
+			return v.fail(address, "PUSHCONST of constant %d, but the constant pool holds %d", operand, len(v.bin.Constants))
+		}
+	case op_getlocal, op_setlocal:
+		if operand < 0 {
+			return v.fail(address, "%s of negative local %d", ins.Opcode.Mnemonic(), operand)
+		}
+	case op_getglobal, op_setglobal:
+		if operand < 0 || operand >= len(v.bin.Globals) {
+			return v.fail(address, "%s of global %d, but the binary declares %d", ins.Opcode.Mnemonic(), operand, len(v.bin.Globals))
+		}
+	case op_nativecall:
+		if v.runtime.FindFunctionById(operand) == nil {
+			return v.fail(address, "NATIVECALL of function %d, which the runtime does not define", operand)
+		}
+	case op_getfield, op_setfield:
+		if _, field := v.runtime.FindFieldById(operand); field == nil {
+			return v.fail(address, "%s of field %d, which the runtime does not define", ins.Opcode.Mnemonic(), operand)
+		}
+	case op_invoke:
+		if _, method := v.runtime.FindMethodById(operand); method == nil {
+			return v.fail(address, "INVOKE of method %d, which the runtime does not define", operand)
+		}
+	case op_tostring:
+		if _, ok := tostringTypes[operand]; !ok {
+			return v.fail(address, "TOSTRING of unknown value type %d", operand)
+		}
+	}
+
+	return nil
+}
+
+// verifyStack follows every path through every method, tracking the stack depth relative to the method entry.
+//
+// A method that is called pops its arguments off the stack of its caller, so its depth goes below zero; the lowest
+// depth it reaches is the number of values it requires, and its depth at RETURN is its net effect on the stack of the
+// caller. Methods are analyzed in rounds until the effect of every method is known and no longer changes. Recursive
+// methods take several rounds: the paths returning without recursing determine the effect first, which is then used
+// for the recursive calls. Methods that never reach a RETURN except through calls to each other, if at all, never
+// return; once no other effect changes, they are marked as such, and the calls to them end their paths.
+func (v *verifier) verifyStack() error {
+	var entries []int
+	for entry := range v.entries {
+		entries = append(entries, entry)
+	}
+	sort.Ints(entries)
+
+	// Every round settles the effect of at least one more method, unless the binary is malformed
+	for round := 0; round <= 2*len(entries)+2; round++ {
+		changed := false
+		stuck := -1
+		partial := map[int]*callEffect{}
+
+		for _, entry := range entries {
+			effect, call, err := v.analyzeMethod(entry)
+			if err != nil {
+				return err
+			}
+
+			if call >= 0 && stuck < 0 {
+				stuck = call
+			}
+
+			// The effect of a method that has not returned yet is only known once all of its paths are followed
+			if !effect.returns && call >= 0 {
+				partial[entry] = effect
+				continue
+			}
+
+			if previous := v.effects[entry]; previous == nil || *previous != *effect {
+				v.effects[entry] = effect
+				changed = true
+			}
+		}
+
+		if changed {
+			continue
+		} else if stuck < 0 {
+			return nil
+		}
+
+		// Nothing changed, so the methods that have not returned yet can only get to a RETURN through each other
+		for entry, effect := range partial {
+			if v.effects[entry] == nil {
+				v.effects[entry] = effect
+				changed = true
+			}
+		}
+
+		if !changed {
+			return v.fail(stuck, "CALL of a method whose stack effect cannot be determined")
+		}
+	}
+
+	return v.fail(-1, "the stack effects of the methods do not settle")
+}
+
+// analyzeMethod determines the stack effect of the method at the given entry address. Paths through a CALL of a method
+// whose effect is not known yet are not followed; the address of the first such CALL is returned, or -1 if every path
+// has been followed.
+func (v *verifier) analyzeMethod(entry int) (*callEffect, int, error) {
+	method := v.entries[entry]
+	depths := map[int]int{entry: 0}
+	work := []int{entry}
+	stuck := -1
+
+	effect := &callEffect{}
+	lowest := 0
+
+	for len(work) > 0 {
+		address := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		ins := v.bin.Code[address]
+		depth := depths[address]
+
+		if (ins.Opcode == op_getlocal || ins.Opcode == op_setlocal) && ins.cpoolIndex >= method.Locals {
+			return nil, -1, v.fail(address, "%s of local %d, but the method has %d", ins.Opcode.Mnemonic(), ins.cpoolIndex, method.Locals)
+		}
+
+		pops, pushes, known := ins.stackEffect(v.runtime, v.callEffect)
+		if !known {
+			if stuck < 0 || address < stuck {
+				stuck = address
+			}
+			continue
+		}
+
+		if depth-pops < lowest {
+			lowest = depth - pops
+		}
+
+		// A method cannot take more values off the stack of its caller than its arguments, and a trigger has none
+		if depth+method.Arguments < pops {
+			return nil, -1, v.fail(address, "%s pops %d values, but the stack holds %d", ins.Opcode.Mnemonic(), pops, depth+method.Arguments)
+		}
+
+		// The stack of the method starts out holding its arguments
+		depth += pushes - pops
+		if depth+method.Arguments > method.MaxStack {
+			return nil, -1, v.fail(address, "stack height %d exceeds the maximum of %d declared for the method", depth+method.Arguments, method.MaxStack)
+		}
+
+		var successors []int
+		switch ins.Opcode {
+		case op_return:
+			if effect.returns && effect.net != depth {
+				return nil, -1, v.fail(address, "RETURN with stack depth %d, but an earlier RETURN of the method has %d", depth, effect.net)
+			}
+			effect.net, effect.returns = depth, true
+		case op_jmp:
+			successors = []int{ins.cpoolIndex}
+		case op_jz:
+			successors = []int{address + 1, ins.cpoolIndex}
+		case op_call:
+			if v.effects[ins.cpoolIndex].returns {
+				successors = []int{address + 1}
+			}
+		default:
+			successors = []int{address + 1}
+		}
+
+		for _, next := range successors {
+			if next >= len(v.bin.Code) {
+				return nil, -1, v.fail(address, "execution continues past the end of the code")
+			}
+
+			if previous, seen := depths[next]; seen {
+				if previous != depth {
+					return nil, -1, v.fail(next, "stack depth is %d along one path and %d along another", previous, depth)
+				}
+				continue
+			}
+
+			depths[next] = depth
+			work = append(work, next)
+		}
+	}
+
+	effect.required = -lowest
+	return effect, stuck, nil
+}
+
+// callEffect returns the stack effect of a CALL to the method at the given address, which is unknown until the
+// method has been analyzed.
+func (v *verifier) callEffect(address int) (pops int, pushes int, known bool) {
+	effect := v.effects[address]
+	if effect == nil {
+		return 0, 0, false
+	}
+
+	// Express the effect as popping the required values and pushing back what remains. A method that never returns
+	// pushes nothing back, but the path calling it ends there anyway.
+	if !effect.returns {
+		return effect.required, 0, true
+	}
+
+	return effect.required, effect.required + effect.net, true
+}
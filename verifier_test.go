@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyEndlessLoops(t *testing.T) {
+	script := loadScript(t, `
+int polls = 0;
+
+func void poll_forever() {
+	while (true) {
+		sleep(1);
+	}
+}
+
+func int forever(int n) {
+	return forever(n);
+}
+
+on program_start() {
+	while (true) {
+		polls = polls + 1;
+		println(polls);
+		sleep(1);
+	}
+}
+
+on number_typed(int number) {
+	if (number == 1) {
+		poll_forever();
+	} else if (number == 2) {
+		println(forever(number));
+	}
+
+	for (;;) {
+		sleep(2);
+	}
+}
+`)
+
+	scheduler := NewScheduler()
+	if err := scheduler.Dispatch(script.vm, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := scheduler.Tick(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script.expectOutput(t, "1", "2", "3")
+	if scheduler.Len() != 1 {
+		t.Fatalf("%d instances suspended, expected the polling one", scheduler.Len())
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	source := `
+func int add(int a, int b) {
+	return a + b;
+}
+
+on program_start() {
+	int x = add(1, 2);
+	if (x == 3) {
+		println("three");
+	}
+}
+`
+
+	for _, test := range []struct {
+		name     string
+		mutate   func(bin *Binary)
+		expected string
+	}{
+		{"unknown opcode", func(bin *Binary) {
+			bin.Code[0].Opcode = 99
+		}, "unknown opcode 99"},
+		{"jump outside of the code", func(bin *Binary) {
+			find(bin, op_jz).cpoolIndex = len(bin.Code) + 5
+		}, "outside of the code"},
+		{"call into the middle of a method", func(bin *Binary) {
+			find(bin, op_call).cpoolIndex++
+		}, "not a method entry"},
+		{"constant out of range", func(bin *Binary) {
+			find(bin, op_pushconst).cpoolIndex = len(bin.Constants)
+		}, "constant pool holds"},
+		{"unknown native function", func(bin *Binary) {
+			find(bin, op_nativecall).cpoolIndex = 99
+		}, "runtime does not define"},
+		{"stack underflow", func(bin *Binary) {
+			bin.Code[bin.Methods[1].Entry] = &Instruction{Opcode: op_eq}
+		}, "but the stack holds 0"},
+		{"stack depth differing between paths", func(bin *Binary) {
+			// Leaves the string of println on the stack in only one branch of the if
+			find(bin, op_nativecall).Opcode = op_yield
+		}, "along one path"},
+		{"max stack too small", func(bin *Binary) {
+			bin.Methods[1].MaxStack = 1
+		}, "exceeds the maximum"},
+		{"local out of range", func(bin *Binary) {
+			bin.Methods[1].Locals = 0
+		}, "but the method has 0"},
+		{"arguments exceeding locals", func(bin *Binary) {
+			bin.Methods[0].Arguments = 3
+		}, "only has 2 locals"},
+		{"trigger taking arguments", func(bin *Binary) {
+			bin.Methods[1].Arguments = 1
+		}, "triggers are not called with any"},
+		{"execution past the end of the code", func(bin *Binary) {
+			bin.Code[len(bin.Code)-1] = &Instruction{Opcode: op_pushconst}
+		}, "past the end of the code"},
+	} {
+		runtime, err := ParseRuntime(testRuntime)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assembler, diagnostics := Compile(runtime, "test.adr", source)
+		if HasErrors(diagnostics) {
+			t.Fatal(diagnostics)
+		}
+
+		bin, err := Decode(assembler.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Verify(bin, runtime); err != nil {
+			t.Fatalf("%s: the unmodified binary failed verification: %s", test.name, err)
+		}
+
+		test.mutate(bin)
+		err = Verify(bin, runtime)
+		if _, ok := err.(*VerifyError); !ok || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected a verify error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+// find returns the first instruction of the binary with the given opcode.
+func find(bin *Binary, op Opcode) *Instruction {
+	for _, v := range bin.Code {
+		if v.Opcode == op {
+			return v
+		}
+	}
+
+	panic("no " + op.Mnemonic() + " in the binary")
+}